@@ -1,673 +1,419 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
-	"sort"
+	"os/signal"
 	"strconv"
 	"strings"
-	"text/template"
+	"syscall"
 	"time"
 
-	"hradek.net/azdl/templates"
+	"hradek.net/azdl/epaper"
 )
 
-const baseURL = "https://epaper.zeitungsverlag-aachen.de/2.0"
+// Exit codes
+const (
+	exitOK      = 0 // Alles in Ordnung
+	exitError   = 1 // Fehler beim Laden oder Schreiben
+	exitUsage   = 2 // Falscher Aufruf
+	exitAuth    = 3 // Anmeldung abgelehnt oder Ausgabe nicht abonniert
+	exitInvalid = 4 // validate hat Fehler gefunden
+)
 
-var standardHeaders = map[string]string{
-	"User-Agent":   "Stephan Hradeks AZAN Epub Builder v0.0",
-	"Content-Type": "application/json;charset=utf-8",
-	"Accept":       "application/json",
-}
+var (
+	// errUsage - Falscher Aufruf, die Meldung wurde bereits ausgegeben
+	errUsage = errors.New("falscher Aufruf")
+	// errInvalid - validate hat Fehler gefunden und ausgegeben
+	errInvalid = errors.New("ungültiges ePub")
+)
 
-type client struct {
-	C            *http.Client
-	Header       http.Header
-	Impressum    string
-	Ausgabe      string
-	BaseURL      string
-	NewspaperURL string
-	Ed2Name      map[string]string
-	Name2Ed      map[string]string
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, cmd *command, args []string) error
 }
 
-type azanlogin struct {
-	Login string `json:"login"`
-	Pass  string `json:"password"`
-}
+var commands []*command
 
-type azanauthorization struct {
-	Authorization string `json:"authorizationHeader"`
-	Error         string `json:"error"`
+func init() {
+	commands = []*command{
+		{"fetch", "[DATUM…]", "Lädt Ausgaben und speichert sie als ePub", runFetch},
+		{"editions", "", "Listet die verfügbaren Ausgaben", runEditions},
+		{"issues", "[DATUM…]", "Zeigt Informationen zu Ausgaben", runIssues},
+		{"validate", "DATEI…", "Prüft ePub Dateien", runValidate},
+		{"cache", "prune", "Räumt den HTTP Cache auf", runCache},
+		{"inspect", "PFAD", "Zeigt die Antwort der API für PFAD, z.B. latest, 20200821/3 oder 20200821/3/88937601", runInspect},
+		{"help", "[KOMMANDO]", "Zeigt die Hilfe", runHelp},
+	}
 }
 
-type ausgabe struct {
-	Paper        string   `json:"paper"`         // az-d
-	Title        string   `json:"title"`         // Dürener Zeitung
-	Date         int      `json:"date"`          // 20060102
-	Brand        string   `json:"brand"`         // az
-	Pages        int      `json:"numberOfPages"` // 14
-	Titles       []string `json:"pageTitles"`    // ["TITELSEITE", "POLITIK"…]
-	Subscription bool     `json:"subscription"`  // true
-	Bought       bool     `json:"bought"`        // false
-	Version      int      `json:"version"`       // 1598303355
+func main() {
+	ctx, stop := signalContext()
+	code := run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
 }
 
-type seite struct {
-	ID       string    `json:"id"`       //  "20200820-47208377",
-	Title    string    `json:"title"`    //  "DIE SEITE DREI",
-	Number   int       `json:"number"`   //  3,
-	Index    int       `json:"index"`    //  2,
-	Width    int       `json:"width"`    //  351,
-	Height   int       `json:"height"`   //  506,
-	Elements []element `json:"elements"` //
-	Free     bool      `json:"free"`     //  false
-	Sequence []element
+// signalContext - Bei SIGINT oder SIGTERM wird der Context abgebrochen,
+// damit angefangene Dateien entfernt werden. Ein zweites Signal beendet
+// das Programm sofort.
+func signalContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Printf("%v, breche ab", sig)
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
 }
 
-type element struct {
-	ID        string `json:"id"`        //  "88937601",
-	XStart    int    `json:"xStart"`    //  12,
-	XEnd      int    `json:"xEnd"`      //  283,
-	YStart    int    `json:"yStart"`    //  45,
-	YEnd      int    `json:"yEnd"`      //  492,
-	Area      int    `json:"area"`      //  121137,
-	Width     int    `json:"width"`     //  620,
-	Height    int    `json:"height"`    //  1024,
-	Type      string `json:"type"`      //  "article",
-	Title     string `json:"title"`     //  "Corona-Hotspot Innenraum",
-	Author    string `json:"author"`    //  "",
-	Underline string `json:"underline"` //  "An der frischen Luft …"
-	Headline  string `json:"headline"`  //  "",
-	Location  string `json:"location"`  //  ""
-	Article   *article
-	Pictures  []picture
+func run(ctx context.Context, args []string) int {
+	log.SetFlags(0)
+	log.SetPrefix("azdl: ")
+
+	if len(args) == 0 {
+		args = []string{"fetch"}
+	}
+	var cmd *command
+	switch args[0] {
+	case "-h", "-help", "--help":
+		cmd, args = findCommand("help"), args[1:]
+	case "-?":
+		// Das alte "azdl -?"
+		cmd, args = findCommand("editions"), args[1:]
+	default:
+		if cmd = findCommand(args[0]); cmd != nil {
+			args = args[1:]
+		} else {
+			// Das alte "azdl [AUSGABE] [DATUM…]"
+			cmd = findCommand("fetch")
+		}
+	}
+	return exitCode(cmd.run(ctx, cmd, args))
 }
 
-type picture struct {
-	ID          string `json:"id"`          //  "2094290259_e7c39b54a0.irprodgera_i14u8q",
-	XStart      int    `json:"xStart"`      //  12,
-	XEnd        int    `json:"xEnd"`        //  62,
-	YStart      int    `json:"yStart"`      //  57,
-	YEnd        int    `json:"yEnd"`        //  93,
-	Area        int    `json:"area"`        //  1800,
-	Width       int    `json:"width"`       //  600,
-	Height      int    `json:"height"`      //  429,
-	Type        string `json:"type"`        //  "picture",
-	Description string `json:"description"` //  null
-	Size        int64
-	Filename    string
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
 }
 
-type page struct {
-	ID     string `json:"id"`     // "20200821-47213513",
-	Index  int    `json:"index"`  // 11,
-	Number int    `json:"number"` // 12,
-	Title  string `json:"title"`  // "LOKALES"
+func exitCode(err error) int {
+	switch {
+	case err == nil, err == flag.ErrHelp:
+		return exitOK
+	case err == errUsage:
+		return exitUsage
+	case err == errInvalid:
+		return exitInvalid
+	case errors.Is(err, epaper.ErrUnauthorized), errors.Is(err, epaper.ErrNotSubscribed):
+		log.Print(err)
+		return exitAuth
+	default:
+		log.Print(err)
+		return exitError
+	}
 }
 
-type link struct {
-	ID    string `json:"id"`
-	Paper paper  `json:"paper"`
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Aufruf: azdl KOMMANDO [OPTIONEN] [PARAMETER]\n\nKommandos:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\n\"azdl KOMMANDO --help\" zeigt die Optionen eines Kommandos.\n")
+	fmt.Fprintf(out, "\nExit Codes: %d ok, %d Fehler, %d falscher Aufruf, %d Anmeldung/Abo, %d ungültiges ePub\n",
+		exitOK, exitError, exitUsage, exitAuth, exitInvalid)
 }
 
-type paper struct {
-	Paper string `json:"paper"` // "az-d",
-	Date  string `json:"date"`  // "20200821",
-	Title string `json:"title"` // "D\u00fcrener Zeitung",
-	Page  page   `json:"page"`
+// options - Die Optionen aller Kommandos
+type options struct {
+	edition     string
+	editions    []string
+	output      string
+	filename    string
+	concurrency int
+	verbose     bool
+	quiet       bool
+	force       bool
+	validate    bool
+	cache       bool
+	offline     bool
+	record      string
+	replay      string
+	// profileName - Das Profil aus der Konfiguration (-profile)
+	profileName string
+	profile     *profile
+	// args - Die Parameter nach den Optionen
+	args []string
 }
 
-type article struct {
-	ID         string    `json:"id"`        //  "88973299",
-	XStart     int       `json:"xStart"`    //  12,
-	XEnd       int       `json:"xEnd"`      //  109,
-	YStart     int       `json:"yStart"`    //  57,
-	YEnd       int       `json:"yEnd"`      //  93,
-	Area       int       `json:"area"`      //  3492,
-	Width      int       `json:"width"`     //  570,
-	Height     int       `json:"height"`    //  209,
-	Type       string    `json:"type"`      //  "article",
-	Title      string    `json:"title"`     //  "",
-	Author     string    `json:"author"`    //  "",
-	Underline  string    `json:"underline"` //  "",
-	Headline   string    `json:"headline"`  //  "",
-	Location   string    `json:"location"`  //  "",
-	Pictures   []picture `json:"pictures"`
-	Paper      paper     `json:"paper"`
-	Text       string    `json:"text"`       //  "<p>Joe Biden<\/p><p>Der Mann, der Donald Trump<br \/>als US-Pr\u00e4sident abl\u00f6sen will<\/p><p>Die Seite Drei<\/p>",
-	Sociallink string    `json:"sociallink"` //  "https:\/\/epaper.zeitungsverlag-aachen.de\/2.0\/article\/327f34db08",
-	Print      string    `json:"print"`      //  "https:\/\/epaper.zeitungsverlag-aachen.de\/2.0\/article\/327f34db08",
-	Wordcount  int       `json:"wordcount"`  //  13
-	Prev       link      `json:"prev"`
-	Next       link      `json:"next"`
-	XMLID      string
-	AltTitle   string
-	Filename   string
+// flagSet - Ein FlagSet für cmd mit den Optionen für die Ausgaben
+func (o *options) flagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Aufruf: azdl %s [OPTIONEN] %s\n\n%s\n\nOptionen:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&o.verbose, "verbose", false, "zeigt jeden Request")
+	fs.BoolVar(&o.verbose, "v", false, "kurz für -verbose")
+	fs.BoolVar(&o.quiet, "quiet", false, "zeigt nur Fehler")
+	fs.BoolVar(&o.quiet, "q", false, "kurz für -quiet")
+	fs.StringVar(&o.profileName, "profile", "", "das Profil aus der Konfiguration, Vorgabe: $AZAN_PROFILE")
+	return fs
 }
 
-type pgInfo struct {
-	Title string
-	Index int
+// editionFlag - Die Ausgabe, vorbelegt aus AZAN_AUSGABE
+func (o *options) editionFlag(fs *flag.FlagSet) {
+	ausgabe := os.Getenv("AZAN_AUSGABE")
+	fs.StringVar(&o.edition, "edition", ausgabe, "die Ausgaben (Kürzel oder Titel, durch Kommas getrennt), Vorgabe: $AZAN_AUSGABE")
+	fs.StringVar(&o.edition, "e", ausgabe, "kurz für -edition")
 }
 
-func main() {
+// downloadFlags - Zielverzeichnis und Parallelität
+func (o *options) downloadFlags(fs *flag.FlagSet) {
+	concurrency := epaper.DefaultConcurrency
+	if parallel, ok := os.LookupEnv("AZAN_PARALLEL"); ok {
+		if n, err := strconv.Atoi(parallel); err == nil && n > 0 {
+			concurrency = n
+		}
+	}
+	fs.StringVar(&o.output, "output", "", "das Verzeichnis für die ePubs")
+	fs.StringVar(&o.output, "o", "", "kurz für -output")
+	fs.StringVar(&o.filename, "filename", os.Getenv("AZAN_FILENAME"), "das Muster für die Dateinamen, z.B. {{.Brand}}/{{.Year}}/{{.Paper}}-{{.Date}}.epub, Vorgabe: $AZAN_FILENAME")
+	fs.IntVar(&o.concurrency, "concurrency", concurrency, "Anzahl paralleler Downloads, Vorgabe: $AZAN_PARALLEL")
+	fs.IntVar(&o.concurrency, "j", concurrency, "kurz für -concurrency")
+	fs.BoolVar(&o.force, "force", false, "erstellt auch unveränderte Ausgaben neu")
+	fs.BoolVar(&o.force, "f", false, "kurz für -force")
+	fs.BoolVar(&o.validate, "validate", false, "prüft jedes erstellte ePub wie validate und bricht bei Fehlern ab")
+}
 
-	client := ePaperClient()
+// networkFlags - HTTP Cache und Aufzeichnungen
+func (o *options) networkFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.cache, "cache", false, "speichert alle Antworten der API im HTTP Cache")
+	fs.BoolVar(&o.offline, "offline", false, "verwendet nur den HTTP Cache, ohne Netzwerk, und erstellt das ePub immer neu")
+	fs.StringVar(&o.record, "record", "", "zeichnet alle Requests und Antworten im Verzeichnis auf, ohne Zugangsdaten")
+	fs.StringVar(&o.replay, "replay", "", "spielt die Aufzeichnungen aus dem Verzeichnis ab, ohne Netzwerk")
+}
 
-	i := 1
-	ausgabe := ""
-	if len(os.Args) > i {
-		mtch, _ := regexp.MatchString(`^(?:latest|\d{8})$`, os.Args[i])
-		if !mtch {
-			ausgabe = os.Args[i]
-			i++
+// parse - Wertet die Optionen aus. Anders als bei flag üblich dürfen
+// Optionen und Parameter gemischt werden, und -N ist ein Datum.
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	for len(args) > 0 {
+		if negativeDate.MatchString(args[0]) {
+			o.args = append(o.args, args[0])
+			args = args[1:]
+			continue
 		}
-	}
-	if ausgabe == "" {
-		var ok bool
-		ausgabe, ok = os.LookupEnv("AZAN_AUSGABE")
-		if !ok {
-			log.Fatal("Umgebungsvariable AZAN_AUSGABE fehlt")
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				return err
+			}
+			return errUsage
 		}
-	} else if ausgabe == "-?" {
-		keys := make([]string, 0, len(client.Name2Ed))
-		for k := range client.Name2Ed {
-			keys = append(keys, k)
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			// Nach -- folgen nur noch Parameter
+			o.args = append(o.args, rest...)
+			break
 		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			fmt.Printf("%-6s: %s\n", client.Name2Ed[k], k)
+		if len(rest) > 0 {
+			o.args = append(o.args, rest[0])
+			rest = rest[1:]
 		}
-		os.Exit(0)
-	}
-	client.ePaperLogin(ausgabe)
-
-	if len(os.Args) < 1+i {
-		client.createAzanEpub("latest")
-		os.Exit(0)
+		args = rest
 	}
-	for i < len(os.Args) {
-		client.createAzanEpub(os.Args[i])
-		i++
+	if o.concurrency < 0 {
+		fmt.Fprintln(fs.Output(), "-concurrency darf nicht negativ sein")
+		return errUsage
 	}
-	os.Exit(0)
+	return o.applyProfile(fs)
 }
 
-func (c *client) createAzanEpub(wantedDate string) {
-
-	// Hole die Basisdatei der gewünschten Ausgabe
-	zeitung := new(ausgabe)
-	c.getJSON(wantedDate, zeitung)
-
-	if !zeitung.Subscription && !zeitung.Bought {
-		log.Fatal(fmt.Sprintf("Die %s wurde weder abonniert noch gekauft", zeitung.Title))
-	}
-
-	// Das Datum ist als String in der Ausgabe hinterlegt
-	strdate := strconv.Itoa(zeitung.Date)
-	date, _ := time.Parse("20060102", strdate)
-
-	// Erstelle eine Datei für das ePub
-	filename := c.Ausgabe + date.Format("-2006-01-02") + ".epub"
-	epubFile, err := os.Create(filename)
+// applyProfile - Lädt das Profil und übernimmt seine Werte für alle
+// Optionen, die weder auf der Kommandozeile noch im Environment
+// gesetzt sind
+func (o *options) applyProfile(fs *flag.FlagSet) error {
+	p, err := loadProfile(o.profileName)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer epubFile.Close()
-
-	azanEpub := zip.NewWriter(epubFile)
-
-	// ToDo: Eventuell müssen Verzeichnisse erstellt werden...
-	// os.MkdirAll("epub/META-INF", 0755)
-	// os.MkdirAll("epub/OEBPS/images", 0755)
-
-	// Füge einige Standard Dateien zum ePub hinzu archive.
-	zipString(azanEpub, "mimetype", "application/epub+zip")
-	c.saveFromURL(azanEpub, strdate+"/0/big", "OEBPS/images/title.jpg")
-	zipString(azanEpub, "OEBPS/title.xhtml", templates.TitlePage)
-	zipString(azanEpub, "OEBPS/zva.epub.css", templates.ZvaCSS)
-	zipString(azanEpub, "META-INF/container.xml", templates.ContainerXML)
-	writeTemplate(azanEpub, "OEBPS/impressum.xhtml", templates.Imprint, struct{ Text string }{c.Impressum})
-	writeTemplate(azanEpub, "OEBPS/index.xhtml", templates.Index, struct {
-		URL     string
-		Ausgabe *ausgabe
-		Date    time.Time
-	}{
-		c.BaseURL,
-		zeitung,
-		date,
+	o.profile = p
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
 	})
-
-	// Array für die Seiten
-	seiten := make([]*seite, zeitung.Pages)
-	// map für die Artikel
-	alleArtikel := map[string]*article{}
-	alleBilder := map[string]*picture{}
-	var duplicateCount int
-	// Durch alle Seiten iterieren
-	for i := 0; i < zeitung.Pages; i++ {
-		fmt.Print(" ", i, "\r")
-
-		// relative URL der Seite
-		seitenURL := strdate + "/" + strconv.Itoa(i)
-
-		// Seite laden
-		dieseSeite := new(seite)
-		c.getJSON(seitenURL, dieseSeite)
-		seiten[i] = dieseSeite
-
-		// Anhand der Verlinkung wird ermittelt,
-		// Welcher Artikel auf derSeite der
-		// erste sein soll
-		ersterArtikel := -1
-
-		// Für die Ermittlung der Reihenfolge müssen wir
-		// von der Artikel-ID auf ihren Index
-		id2idx := make(map[string]int)
-		// und vom Index auf die Artikel-ID des Folgeartikels
-		// schließen können
-		idx2next := make([]string, len(dieseSeite.Elements))
-
-		// iteriere durch die Seitenelemente
-		for idx, element := range dieseSeite.Elements {
-			// Wir laden nur Titel, Keine Werbung, keine Bilder
-			switch element.Type {
-			case "article":
-				// Hole den Artikel
-				artikel := new(article)
-				c.getJSON(seitenURL+"/"+element.ID, artikel)
-
-				var templ *template.Template
-				if original, duplicate := alleArtikel[artikel.ID]; duplicate {
-					// Doppelter Artikel
-					duplicateCount++
-					artikel.Filename = "duplicate_" + artikel.ID + ".xhtml"
-					artikel.Underline = `<a href="article_` + artikel.ID + `.xhtml">Seite ` + strconv.Itoa(original.Paper.Page.Number) + `</a>`
-					artikel.AltTitle = original.AltTitle
-					artikel.XMLID = "duplicate_" + strconv.Itoa(duplicateCount)
-					alleArtikel[artikel.XMLID] = artikel
-					id2idx[artikel.XMLID] = idx
-					idx2next[idx] = artikel.Next.ID
-					idx2next[id2idx[artikel.Prev.ID]] = artikel.XMLID
-					dieseSeite.Elements[idx].Article = artikel
-					templ = templates.DupArticle
-				} else {
-					artikel.Filename = "article_" + artikel.ID + ".xhtml"
-					artikel.XMLID = "article_" + artikel.ID
-
-					// Verknüpfungen
-					alleArtikel[artikel.ID] = artikel
-					id2idx[artikel.ID] = idx
-					idx2next[idx] = artikel.Next.ID
-
-					// Alternativtitel erstellen aus
-					// dem Inhalt des Artikels
-					altTitle := cheapExerpt(artikel)
-					clean(artikel)
-					artikel.AltTitle = altTitle
-					dieseSeite.Elements[idx].Article = artikel
-					dieseSeite.Elements[idx].Pictures = artikel.Pictures
-
-					// Bilder holen
-					for idx, picture := range artikel.Pictures {
-						bild := "images/" + picture.ID + ".jpg"
-						if _, ok := alleBilder[bild]; !ok {
-							filename := "images/" + picture.ID + ".jpg"
-							size := c.saveFromURL(azanEpub, seitenURL+"/"+picture.ID+"/jpg", "OEBPS/"+filename)
-							alleBilder[bild] = &artikel.Pictures[idx]
-							artikel.Pictures[idx].Size = size
-							artikel.Pictures[idx].Filename = filename
-							if size < 1 {
-								fmt.Println("Fehlendes Bild Seite ", dieseSeite.Number, " ", altTitle)
-							}
-						}
-					}
-					templ = templates.Article
-				}
-				// xhtml Datei für den Artikel erstellen
-				date, _ := time.Parse("20060102", artikel.Paper.Date)
-				writeTemplate(azanEpub, "OEBPS/"+artikel.Filename, templ, struct {
-					URL  string
-					A    *article
-					Date time.Time
-				}{
-					c.BaseURL,
-					artikel,
-					date,
-				})
-
-				// Prüfe, ob es sich um den ersten Artikel handelt
-				if ersterArtikel < 0 && (artikel.Prev.ID == "" || artikel.Prev.Paper.Page.Index < artikel.Paper.Page.Index) {
-					ersterArtikel = idx
-				}
-
-			default:
-				// Alles ausser article wird ignoriert.
-			}
-		}
-		// Reihenfolge der Artikel auf der Seite ermitteln
-		dieseSeite.Sequence = make([]element, len(id2idx))
-		art := ersterArtikel
-		for i := 0; art >= 0; i++ {
-			dieseSeite.Sequence[i] = dieseSeite.Elements[art]
-			nextID := idx2next[art]
-			if nextID == "" {
-				break
-			}
-			var ok bool
-			if art, ok = id2idx[nextID]; !ok {
-				break
-			}
-		}
-
-		// Vorgänger und Nachfolger für
-		// die Inhaltsangaben der Seiten
-		var nextPage pgInfo
-		if i+1 < zeitung.Pages {
-			nextPage.Index = i + 1
-			nextPage.Title = zeitung.Titles[i+1]
-		}
-		var prevPage pgInfo
-		if i > 0 {
-			prevPage.Index = i - 1
-			prevPage.Title = zeitung.Titles[i-1]
-		}
-
-		// Inhaltsangabe der Seite erstellen
-		writeTemplate(azanEpub, "OEBPS/seite_"+strconv.Itoa(dieseSeite.Index)+".xhtml", templates.Seite, struct {
-			URL     string
-			Ausgabe *ausgabe
-			Seite   *seite
-			Date    time.Time
-			Prev    pgInfo
-			Next    pgInfo
-		}{
-			c.BaseURL,
-			zeitung,
-			dieseSeite,
-			date,
-			prevPage,
-			nextPage,
-		})
+	use := func(name, short, env string) bool {
+		_, isEnv := os.LookupEnv(env)
+		return fs.Lookup(name) != nil && !set[name] && !set[short] && !isEnv
 	}
-
-	// Daten für Table Of Content etc.
-	data := struct {
-		URL         string
-		Ausgabe     *ausgabe
-		Seiten      []*seite
-		Date        time.Time
-		AlleArtikel map[string]*article
-		AlleBilder  map[string]*picture
-	}{
-		c.BaseURL,
-		zeitung,
-		seiten,
-		date,
-		alleArtikel,
-		alleBilder,
+	if use("edition", "e", "AZAN_AUSGABE") && len(p.Editions) > 0 {
+		o.edition = strings.Join(p.Editions, ",")
 	}
-
-	// ePub Steuerdateien erstellen
-	writeTemplate(azanEpub, "OEBPS/toc.ncx", templates.ToC, data)
-	writeTemplate(azanEpub, "OEBPS/content.opf", templates.ContentOPF, data)
-	writeTemplate(azanEpub, "OEBPS/navigation.xhtml", templates.NAV, data)
-
-	// Make sure to check the error on Close.
-	err = azanEpub.Close()
-	if err != nil {
-		log.Fatal(err)
+	if use("output", "o", "") && p.Output != "" {
+		o.output = expandHome(p.Output)
 	}
-}
-
-func newTemplate(name string, funcMap template.FuncMap, tpl string) *template.Template {
-	result, err := template.New(name).Funcs(funcMap).Parse(tpl)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(5)
+	if use("filename", "", "AZAN_FILENAME") && p.Filename != "" {
+		o.filename = p.Filename
 	}
-	return result
-}
-
-func writeTemplate(zipWriter *zip.Writer, filename string, tpl *template.Template, data interface{}) {
-	f, err := zipWriter.Create(filename)
-	if err != nil {
-		log.Fatal(err)
+	if o.filename != "" {
+		if _, err := epaper.ParseFilename(o.filename); err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			return errUsage
+		}
 	}
-	err = tpl.Execute(f, data)
-	if err != nil {
-		log.Fatal(err)
+	if use("cache", "", "") && p.Cache {
+		o.cache = true
+	}
+	if use("concurrency", "j", "AZAN_PARALLEL") && p.Concurrency > 0 {
+		o.concurrency = p.Concurrency
 	}
+	if use("validate", "", "") && p.Validate {
+		o.validate = true
+	}
+	return nil
 }
 
-func (c *client) saveFromURL(zipWriter *zip.Writer, relativeURL, filename string) int64 {
-	request, _ := http.NewRequest("GET", c.NewspaperURL+"/"+relativeURL, nil)
-	request.Header = c.Header.Clone()
-	response, err := c.C.Do(request)
-	if err != nil {
-		log.Fatal(err)
+// newClient - Erstellt den Client entsprechend der Optionen
+func (o *options) newClient(ctx context.Context) (*epaper.Client, error) {
+	// Alle Requests laufen über transport
+	var transport http.RoundTripper = http.DefaultTransport
+	if o.replay != "" {
+		replay, err := epaper.NewReplayTransport(o.replay)
+		if err != nil {
+			return nil, err
+		}
+		transport = replay
 	}
-	defer response.Body.Close()
-	size := response.ContentLength
-	if 0 == size {
-		return 0
+	if o.record != "" {
+		transport = &epaper.RecordTransport{Dir: o.record, Next: transport}
 	}
-	f, err := zipWriter.Create(filename)
-	if err != nil {
-		log.Fatal(err)
+	if o.verbose {
+		transport = &loggingTransport{transport}
 	}
 
-	_, err = io.Copy(f, response.Body)
-	if err != nil {
-		log.Fatal(err)
+	var (
+		client *epaper.Client
+		err    error
+	)
+	if o.offline {
+		var dir string
+		if dir, err = epaper.DefaultCacheDir(); err == nil {
+			client, err = epaper.NewOfflineClient(ctx, dir)
+		}
+	} else {
+		client, err = epaper.NewClientWithTransport(ctx, transport)
 	}
-	return size
-}
-
-func (c *client) getInfos(impressumURL string) {
-	request, err := http.NewRequest("GET", c.BaseURL+impressumURL, nil)
-	request.Header = c.Header.Clone()
-	response, err := c.C.Do(request)
 	if err != nil {
-		log.Fatal(err)
-		os.Exit(3)
+		return nil, err
 	}
-	defer response.Body.Close()
-
-	// den response body als string holen
-	dataInBytes, err := ioutil.ReadAll(response.Body)
-	pageContent := string(dataInBytes)
-
-	// Impressum suchen
-	indicator := "<h1>Impressum</h1>"
-	impressumPos := strings.Index(pageContent, indicator)
-	if impressumPos == -1 {
-		fmt.Printf("Kein Impressum in %s gefunden.\n", impressumURL)
-	} else {
-		// Das Ende des Impressum suchen
-		impressumPos += len(indicator)
-		impressumEnd := strings.Index(pageContent[impressumPos:], "')")
-		if impressumEnd == -1 {
-			impressumEnd = len(pageContent)
-		} else {
-			impressumEnd += impressumPos
+	if o.cache && !o.offline {
+		if client.Cache, err = epaper.DefaultCacheDir(); err != nil {
+			return nil, err
 		}
-
-		// br und Zeilenenden erstzen und das als Ergebnis liefern
-		c.Impressum = strings.Replace(strings.Replace(
-			pageContent[impressumPos:impressumEnd],
-			"<br>", "<br />", -1),
-			"\\n", "\n", -1)
-	}
-	// Editionen suchen
-	editions := regexp.MustCompile(`paper:"([^"]+)",title:"([^"]+)",`).FindAllStringSubmatch(pageContent, -1)
-	for _, edition := range editions {
-		c.Ed2Name[edition[1]] = edition[2]
-		c.Name2Ed[edition[2]] = edition[1]
 	}
-}
-
-// Artikel "reinigen"
-func clean(artikel *article) {
-	artikel.Text =
-		templates.Ortsmarke.ReplaceAllString(
-			templates.MTbr.ReplaceAllString(
-				templates.NoLinkTarget.ReplaceAllString(
-					templates.EntityReplace.Replace(artikel.Text),
-					`$1`),
-				`$1`),
-			`$1$3$2`)
-	artikel.Title = templates.EntityReplace.Replace(artikel.Title)
-	artikel.Underline = templates.EntityReplace.Replace(artikel.Underline)
-}
-
-// Erstellen eines Alternativtitels
-func cheapExerpt(artikel *article) string {
-	// Den vorhandenen Titel nehmen
-	if artikel.Title != "" {
-		return artikel.Title
-	}
-	// Sonst, wenn kein Artikeltext vorhanden
-	txt := artikel.Text
-	if txt == "" {
-		// Wenn kein Bild vorhandeen is
-		if len(artikel.Pictures) < 1 {
-			return "Leerer Artikel"
-		}
-		// Und keine Bildbeschreibung fürs erste Bild
-		txt = artikel.Pictures[0].Description
-		if txt == "" {
-			// Dann generiere einen Bildnamen aus den Dimensionen des Bildes
-			// Bekannte Dimensionen (DAX, Wetter, Festgeld...)
-			// werden durch feste Namen ersetzt. Siehe templates.go
-			bildname := templates.Bildnamen.Replace(
-				fmt.Sprintf("Bild %d × %d", artikel.Width, artikel.Height))
-			fmt.Println(artikel.Pictures[0].ID, " ", bildname)
-			return bildname
+	if !o.quiet {
+		client.Log = log.New(os.Stderr, "", 0)
+		client.Progress = func(page, pages int) {
+			fmt.Fprint(os.Stderr, " ", page, "\r")
 		}
 	}
-	// Aufbereiten des Textes
-	// - Erstes Tag entfernen
-	// - Ab dem ersten </p> alles abschneiden
-	// - "Locationmark" entfernen
-	// - Alle Tags löschen
-	txt = templates.RemoveTags.ReplaceAllString(
-		templates.RemoveLocationMark.ReplaceAllString(
-			templates.CutOffParagraphs.ReplaceAllString(
-				templates.KillFirstTag.ReplaceAllString(txt,
-					``),
-				``),
-			``),
-		``)
-	// Texte über 40 Zeichen länge kürzen
-	if len(txt) > 40 {
-		txt = templates.Shorten.ReplaceAllString(txt, `$1…`)
-	}
-	return txt
-}
-
-func ePaperClient() *client {
-	// Erstelle HTTP client
-	myclient := client{
-		C: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		Header:  http.Header{},
-		BaseURL: baseURL,
-		Ed2Name: make(map[string]string),
-		Name2Ed: make(map[string]string),
-	}
-	for k, v := range standardHeaders {
-		myclient.Header.Set(k, v)
-	}
-	myclient.BaseURL = baseURL
-
-	// Impressum und Editionen laden
-	myclient.getInfos("/js/app-b4b5468874.js")
-
-	return &myclient
+	if o.concurrency > 0 {
+		client.Concurrency = o.concurrency
+	}
+	client.OutputDir = o.output
+	client.Filename = o.filename
+	if o.profile != nil {
+		if o.profile.CSS != "" {
+			css, err := ioutil.ReadFile(expandHome(o.profile.CSS))
+			if err != nil {
+				return nil, err
+			}
+			client.CSS = string(css)
+		}
+		client.SkipPages = o.profile.SkipPages
+	}
+	if client.TokenCache, err = epaper.DefaultTokenCache(); err != nil && !o.quiet {
+		log.Print("Kein Session Cache: ", err)
+	}
+	if client.StateFile, err = epaper.DefaultStateFile(); err != nil && !o.quiet {
+		log.Print("Keine Statusdatei: ", err)
+	}
+	// Offline wird das ePub aus dem Cache immer neu erstellt, auch wenn
+	// sich die Version der Ausgabe nicht geändert hat
+	client.Force = o.force || o.offline
+	client.Validate = o.validate
+	if o.record != "" || o.replay != "" {
+		// Eine Aufzeichnung muss die Anmeldung und alle Downloads
+		// enthalten, also weder eine gespeicherte Anmeldung noch das
+		// vorige ePub verwenden. Die aufgezeichnete Anmeldung ist
+		// unkenntlich gemacht und darf die echte nicht ersetzen.
+		// Jeder Lauf erstellt das ePub neu.
+		client.TokenCache = ""
+		client.StateFile = ""
+		client.Force = true
+	}
+	return client, nil
 }
 
-func (c *client) ePaperLogin(azanAusgabe string) {
-	edTitel := c.Ed2Name[azanAusgabe]
-	edition := c.Name2Ed[azanAusgabe]
-	if edTitel != "" {
-		edition = azanAusgabe
-	} else if edition != "" {
-		edTitel = azanAusgabe
-	} else {
-		log.Fatal(fmt.Sprintf("Es gibt keine Ausgabe %s der Aachener Zeitung.\n", azanAusgabe))
-	}
-	apiURL := c.BaseURL + "/api/"
-	c.NewspaperURL = apiURL + edition
-	c.Ausgabe = edition
-	// Die credentials aus dem Environment holen
-	body := &azanlogin{
-		Login: os.Getenv("AZAN_USER"),
-		Pass:  os.Getenv("AZAN_PASS"),
-	}
-	// and prepare for login
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(body)
-
-	// Log in
-	request, err := http.NewRequest("POST", apiURL+"user/login", buf)
-	if err != nil {
-		log.Fatal(err)
+// login - Erstellt den Client und meldet ihn für die erste Ausgabe an
+func (o *options) login(ctx context.Context) (*epaper.Client, error) {
+	if o.editions == nil {
+		o.editions = splitEditions(o.edition)
 	}
-
-	auth := new(azanauthorization)
-	// Make login request
-	c.fetchJSON(request, auth)
-	if auth.Error != "" {
-		log.Fatal(auth.Error)
+	if len(o.editions) == 0 {
+		log.Print("Keine Ausgabe angegeben: -edition oder AZAN_AUSGABE fehlt")
+		return nil, errUsage
 	}
-
-	// Set authorization
-	c.Header.Set("Authorization", auth.Authorization)
-}
-
-func (c *client) getJSON(relativeURL string, target interface{}) {
-	request, _ := http.NewRequest("GET", c.NewspaperURL+"/"+relativeURL, nil)
-	c.fetchJSON(request, target)
-}
-func (c *client) fetchJSON(request *http.Request, target interface{}) {
-	request.Header = c.Header.Clone()
-	response, err := c.C.Do(request)
+	client, err := o.newClient(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	// Offline und beim Abspielen wird keine Anmeldung gebraucht
+	var user, pass string
+	if !o.offline && o.replay == "" {
+		if user, pass, err = o.credentials(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.Login(ctx, o.editions[0], user, pass); err != nil {
+		return nil, err
 	}
-	defer response.Body.Close()
-	// parse the page data
-	json.NewDecoder(response.Body).Decode(target)
+	return client, nil
 }
 
-func zipString(zipWriter *zip.Writer, filename string, content string) {
+// loggingTransport - Protokolliert jeden Request (-verbose)
+type loggingTransport struct {
+	next http.RoundTripper
+}
 
-	var f io.Writer
-	var err error
-	if filename == "mimetype" {
-		f, err = zipWriter.CreateHeader(&zip.FileHeader{
-			Name:   filename,
-			Method: zip.Store,
-		})
-	} else {
-		f, err = zipWriter.Create(filename)
-	}
+func (t *loggingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
 	if err != nil {
-		log.Fatal(err)
-	}
-	_, err = f.Write([]byte(content))
-	if err != nil {
-		log.Fatal(err)
+		log.Printf("%s %s: %v", request.Method, request.URL, err)
+	} else {
+		log.Printf("%s %s: %s (%s)", request.Method, request.URL, response.Status, time.Since(start).Round(time.Millisecond))
 	}
+	return response, err
 }
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hradek.net/azdl/epaper"
+	"hradek.net/azdl/epubcheck"
+)
+
+// dateArgs - Trennt die Daten von den Ausgaben, die wie bisher
+// ohne -edition angegeben werden können
+func (o *options) dateArgs(fs *flag.FlagSet) ([]wantedDate, error) {
+	editionSet := false
+	fs.Visit(func(f *flag.Flag) {
+		editionSet = editionSet || f.Name == "edition" || f.Name == "e"
+	})
+	now := time.Now()
+	var (
+		dates    []wantedDate
+		editions []string
+	)
+	for _, arg := range o.args {
+		expanded, err := expandDate(arg, now)
+		if err == nil {
+			dates = append(dates, expanded...)
+			continue
+		}
+		if dateShaped(arg) {
+			fmt.Fprintln(fs.Output(), err)
+			return nil, errUsage
+		}
+		editions = append(editions, splitEditions(arg)...)
+	}
+	// Ausgaben als Parameter ersetzen $AZAN_AUSGABE, ergänzen aber -edition
+	o.editions = splitEditions(o.edition)
+	if len(editions) > 0 {
+		if !editionSet {
+			o.editions = nil
+		}
+		o.editions = append(o.editions, editions...)
+	}
+	if len(dates) < 1 {
+		dates = []wantedDate{{date: "latest"}}
+	}
+	return dates, nil
+}
+
+// splitEditions - Mehrere Ausgaben werden durch Kommas getrennt
+func splitEditions(editions string) []string {
+	var result []string
+	for _, edition := range strings.Split(editions, ",") {
+		if edition = strings.TrimSpace(edition); edition != "" {
+			result = append(result, edition)
+		}
+	}
+	return result
+}
+
+func runFetch(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	o.editionFlag(fs)
+	o.networkFlags(fs)
+	o.downloadFlags(fs)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	dates, err := o.dateArgs(fs)
+	if err != nil {
+		return err
+	}
+	client, err := o.login(ctx)
+	if err != nil {
+		return err
+	}
+	// Alle Ausgaben eines Tages nacheinander, damit gemeinsame
+	// Artikel und Bilder nur einmal geladen werden
+	for _, date := range dates {
+		for _, edition := range o.editions {
+			if err := client.SelectEdition(edition); err != nil {
+				return err
+			}
+			filename, err := client.CreateAzanEpub(ctx, date.date)
+			if date.inRange && errors.Is(err, epaper.ErrNoIssue) {
+				if !o.quiet {
+					log.Printf("Keine Ausgabe %s am %s", client.Ausgabe, date.date)
+				}
+				continue
+			}
+			if errors.Is(err, epaper.ErrUnchanged) {
+				if !o.quiet {
+					log.Printf("%s ist aktuell", filename)
+				}
+				continue
+			}
+			var invalid *epaper.InvalidError
+			if errors.As(err, &invalid) {
+				printProblems(os.Stderr, invalid.Filename, invalid.Problems)
+				return errInvalid
+			}
+			if err != nil {
+				return err
+			}
+			if err := o.profile.deliver(filename); err != nil {
+				return err
+			}
+			fmt.Println(filename)
+		}
+	}
+	return nil
+}
+
+func runEditions(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	if len(o.args) > 0 {
+		fs.Usage()
+		return errUsage
+	}
+	client, err := o.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(client.Name2Ed))
+	for k := range client.Name2Ed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		edition := client.Name2Ed[k]
+		if brand := client.Editions[edition].Brand; o.verbose && brand != "" {
+			fmt.Printf("%-6s: %s [%s]\n", edition, k, brand)
+		} else {
+			fmt.Printf("%-6s: %s\n", edition, k)
+		}
+	}
+	return nil
+}
+
+func runIssues(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	o.editionFlag(fs)
+	o.networkFlags(fs)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	dates, err := o.dateArgs(fs)
+	if err != nil {
+		return err
+	}
+	client, err := o.login(ctx)
+	if err != nil {
+		return err
+	}
+	for _, date := range dates {
+		for _, edition := range o.editions {
+			if err := client.SelectEdition(edition); err != nil {
+				return err
+			}
+			zeitung, err := client.Issue(ctx, date.date)
+			if date.inRange && errors.Is(err, epaper.ErrNoIssue) {
+				fmt.Printf("%s  %-6s  keine Ausgabe\n", date.date, client.Ausgabe)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			day, _ := time.Parse("20060102", strconv.Itoa(zeitung.Date))
+			status := "nicht abonniert"
+			if zeitung.Subscription {
+				status = "abonniert"
+			} else if zeitung.Bought {
+				status = "gekauft"
+			}
+			fmt.Printf("%s  %-6s  %s  %d Seiten  Version %d  %s\n",
+				day.Format("2006-01-02"), zeitung.Paper, zeitung.Title, zeitung.Pages, zeitung.Version, status)
+		}
+	}
+	return nil
+}
+
+func runValidate(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	if len(o.args) < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	invalid := false
+	for _, filename := range o.args {
+		valid, err := validate(os.Stdout, filename)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			invalid = true
+		} else if !o.quiet {
+			fmt.Printf("%s: ok\n", filename)
+		}
+	}
+	if invalid {
+		return errInvalid
+	}
+	return nil
+}
+
+// validate - Prüft das ePub filename und gibt die Probleme auf w aus
+func validate(w io.Writer, filename string) (bool, error) {
+	problems, err := epubcheck.Check(filename)
+	if err != nil {
+		return false, err
+	}
+	printProblems(w, filename, problems)
+	return len(problems) == 0, nil
+}
+
+// printProblems - Gibt die Probleme im ePub filename auf w aus
+func printProblems(w io.Writer, filename string, problems []epubcheck.Problem) {
+	for _, p := range problems {
+		fmt.Fprintf(w, "%s: %s\n", filename, p)
+	}
+}
+
+func runCache(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	maxAge := fs.Duration("max-age", 30*24*time.Hour, "entfernt Einträge, die so lange nicht verwendet wurden, 0 für unbegrenzt")
+	maxSize := byteSize(0)
+	fs.Var(&maxSize, "max-size", "entfernt die ältesten Einträge, bis der Cache nicht größer ist, z.B. 500M oder 2G")
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	if len(o.args) != 1 || o.args[0] != "prune" {
+		fs.Usage()
+		return errUsage
+	}
+	dir, err := epaper.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	removed, freed, err := epaper.PruneCache(dir, *maxAge, int64(maxSize))
+	if err != nil {
+		return err
+	}
+	if !o.quiet {
+		fmt.Printf("%s: %d Einträge entfernt, %s freigegeben\n", dir, removed, byteSize(freed))
+	}
+	return nil
+}
+
+func runInspect(ctx context.Context, cmd *command, args []string) error {
+	var o options
+	fs := o.flagSet(cmd)
+	o.editionFlag(fs)
+	o.networkFlags(fs)
+	if err := o.parse(fs, args); err != nil {
+		return err
+	}
+	if len(o.args) != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	client, err := o.login(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := client.Raw(ctx, o.args[0])
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if json.Indent(&out, data, "", "  ") != nil {
+		// Kein JSON, z.B. ein Bild
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
+
+func runHelp(ctx context.Context, cmd *command, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	if help := findCommand(args[0]); help != nil && help != cmd {
+		return help.run(ctx, help, []string{"-help"})
+	}
+	usage()
+	return errUsage
+}
+
+// byteSize - Eine Größe wie 500M oder 2G
+type byteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}}
+
+func (b *byteSize) Set(arg string) error {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(arg)), "B")
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, factor = strings.TrimSuffix(value, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("ungültige Größe %q", arg)
+	}
+	*b = byteSize(n * float64(factor))
+	return nil
+}
+
+func (b byteSize) String() string {
+	for _, unit := range sizeUnits {
+		if int64(b) >= unit.factor {
+			return strconv.FormatFloat(float64(b)/float64(unit.factor), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
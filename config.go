@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"hradek.net/azdl/epaper"
+)
+
+// config - Die Konfigurationsdatei, z.B.
+//
+//	default_profile = "home"
+//
+//	[profiles.home]
+//	user = "my.account@medienhaus.ac"
+//	editions = ["az-d", "an-a1"]
+//	output = "~/Zeitung"
+type config struct {
+	DefaultProfile string              `toml:"default_profile"`
+	Profiles       map[string]*profile `toml:"profiles"`
+}
+
+// profile - Ein benanntes Profil der Konfiguration
+type profile struct {
+	User        string   `toml:"user"`
+	Password    string   `toml:"password"`
+	Editions    []string `toml:"editions"`
+	Output      string   `toml:"output"`
+	Filename    string   `toml:"filename"`
+	CSS         string   `toml:"css"`
+	SkipPages   []string `toml:"skip_pages"`
+	Deliver     []string `toml:"deliver"`
+	Concurrency int      `toml:"concurrency"`
+	Cache       bool     `toml:"cache"`
+	Validate    bool     `toml:"validate"`
+
+	// PasswordFile - Eine nur für den Besitzer lesbare Datei mit dem Passwort
+	PasswordFile string `toml:"password_file"`
+	// PasswordCommand - Ein Kommando, das das Passwort ausgibt
+	PasswordCommand string `toml:"password_command"`
+}
+
+// configFile - Der Ort der Konfiguration: $AZAN_CONFIG oder
+// config.toml im Konfigurationsverzeichnis des Benutzers
+func configFile() (string, error) {
+	if filename, ok := os.LookupEnv("AZAN_CONFIG"); ok {
+		return filename, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azdl", "config.toml"), nil
+}
+
+// loadProfile - Lädt das Profil name. Ohne Namen wird $AZAN_PROFILE,
+// default_profile oder das Profil "default" verwendet. Fehlt die
+// Konfiguration, gibt es nur ein leeres Profil.
+func loadProfile(name string) (*profile, error) {
+	filename, err := configFile()
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	meta, err := toml.DecodeFile(filename, &cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		if name != "" {
+			return nil, fmt.Errorf("Profil %s nicht gefunden, %s fehlt", name, filename)
+		}
+		return &profile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unbekannte Einstellung %s", filename, undecoded[0])
+	}
+
+	explicit := name != ""
+	if name == "" {
+		name = os.Getenv("AZAN_PROFILE")
+		explicit = name != ""
+	}
+	if name == "" {
+		name = cfg.DefaultProfile
+		explicit = name != ""
+	}
+	if name == "" {
+		name = "default"
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		if explicit {
+			return nil, fmt.Errorf("%s: Profil %s nicht gefunden", filename, name)
+		}
+		return &profile{}, nil
+	}
+	if p.Password != "" {
+		if err := checkPrivate(filename); err != nil {
+			return nil, fmt.Errorf("Profil %s enthält ein Passwort: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// expandHome - Ersetzt ein führendes ~ durch das Home Verzeichnis
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// deliver - Kopiert das fertige ePub in die Verzeichnisse des Profils
+func (p *profile) deliver(filename string) error {
+	for _, target := range p.Deliver {
+		dir := expandHome(target)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filename, filepath.Join(dir, filepath.Base(filename))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Kein Leser soll eine halbe Datei zu sehen bekommen
+	return epaper.WriteFileAtomic(to, 0644, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
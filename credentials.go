@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+	"hradek.net/azdl/epaper"
+)
+
+// credentials - Benutzer und Passwort für die Anmeldung. Die Quellen
+// werden in dieser Reihenfolge befragt, bis beides bekannt ist:
+// Environment, Profil, Passwortdatei, Passwortkommando, .netrc und
+// zuletzt die Eingabe am Terminal.
+func (o *options) credentials(ctx context.Context) (user, pass string, err error) {
+	p := o.profile
+	user, pass = p.User, p.Password
+	if env, ok := os.LookupEnv("AZAN_USER"); ok {
+		user = env
+	}
+	if env, ok := os.LookupEnv("AZAN_PASS"); ok {
+		pass = env
+	}
+
+	if pass == "" {
+		filename := p.PasswordFile
+		if env, ok := os.LookupEnv("AZAN_PASS_FILE"); ok {
+			filename = env
+		}
+		if filename != "" {
+			if pass, err = readSecretFile(expandHome(filename)); err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	if pass == "" {
+		command := p.PasswordCommand
+		if env, ok := os.LookupEnv("AZAN_PASS_COMMAND"); ok {
+			command = env
+		}
+		if command != "" {
+			if pass, err = runSecretCommand(ctx, command); err != nil {
+				return "", "", err
+			}
+		}
+	}
+
+	if user == "" || pass == "" {
+		login, password, err := netrcLookup(user)
+		if err != nil {
+			return "", "", err
+		}
+		if user == "" {
+			user = login
+		}
+		if pass == "" && login == user {
+			pass = password
+		}
+	}
+
+	if user == "" || pass == "" {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return user, pass, nil
+		}
+		if user == "" {
+			fmt.Fprint(os.Stderr, "Benutzer: ")
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return "", "", err
+			}
+			user = strings.TrimSpace(line)
+		}
+		if pass == "" {
+			fmt.Fprint(os.Stderr, "Passwort für ", user, ": ")
+			password, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return "", "", err
+			}
+			pass = string(password)
+		}
+	}
+	return user, pass, nil
+}
+
+// readSecretFile - Liest das Passwort aus der ersten Zeile von filename.
+// Die Datei darf nur für den Besitzer lesbar sein.
+func readSecretFile(filename string) (string, error) {
+	if err := checkPrivate(filename); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(data), nil
+}
+
+// checkPrivate - Eine Datei mit einem Passwort darf nur für den
+// Besitzer lesbar sein. Unter Windows wird das nicht geprüft.
+func checkPrivate(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s darf nur für den Besitzer lesbar sein (chmod 600)", filename)
+	}
+	return nil
+}
+
+// runSecretCommand - Das Passwort ist die erste Zeile der Ausgabe von
+// command, z.B. "pass show azan"
+func runSecretCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// Das Kommando darf selbst nachfragen, z.B. nach der Passphrase
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Passwortkommando %q: %w", command, err)
+	}
+	return firstLine(out), nil
+}
+
+func firstLine(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimRight(string(data), "\r")
+}
+
+// netrcLookup - Sucht den Eintrag für den Server des ePapers in $NETRC
+// oder ~/.netrc. Ist user bekannt, zählt nur ein Eintrag mit diesem Login.
+func netrcLookup(user string) (login, password string, err error) {
+	filename := os.Getenv("NETRC")
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		filename = filepath.Join(home, ".netrc")
+		if runtime.GOOS == "windows" {
+			filename = filepath.Join(home, "_netrc")
+		}
+	}
+	// Wie bei ftp und curl wird eine für andere lesbare Datei abgelehnt
+	err = checkPrivate(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", "", err
+	}
+	base, err := url.Parse(epaper.BaseURL)
+	if err != nil {
+		return "", "", err
+	}
+	for _, entry := range parseNetrc(string(data)) {
+		if entry.machine != base.Hostname() && entry.machine != "" {
+			continue
+		}
+		if user == "" || entry.login == user {
+			return entry.login, entry.password, nil
+		}
+	}
+	return "", "", nil
+}
+
+// netrcEntry - Ein machine oder default Eintrag (machine ist dann leer)
+type netrcEntry struct {
+	machine, login, password string
+}
+
+// parseNetrc - Die Einträge in der Reihenfolge der Datei. Da default
+// nur zuletzt stehen darf, gewinnt ein passender machine Eintrag.
+func parseNetrc(data string) []netrcEntry {
+	var (
+		entries []netrcEntry
+		entry   *netrcEntry
+		inMacro bool
+	)
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			// Ein Makro endet mit einer Leerzeile
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			value := ""
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: value})
+				entry = &entries[len(entries)-1]
+				i++
+			case "default":
+				entries = append(entries, netrcEntry{})
+				entry = &entries[len(entries)-1]
+			case "login", "password", "account":
+				if entry != nil && fields[i] == "login" {
+					entry.login = value
+				} else if entry != nil && fields[i] == "password" {
+					entry.password = value
+				}
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			default:
+				if strings.HasPrefix(fields[i], "#") {
+					i = len(fields)
+				}
+			}
+		}
+	}
+	return entries
+}
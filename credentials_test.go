@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNetrcLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Dateirechte werden unter Windows nicht geprüft")
+	}
+	netrc := "machine epaper.zeitungsverlag-aachen.de\n  login leser\n  password geheim\n"
+	tests := []struct {
+		name     string
+		perm     os.FileMode
+		password string
+		err      string
+	}{
+		{"private", 0600, "geheim", ""},
+		{"readable by others", 0644, "", "chmod 600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "netrc")
+			if err := ioutil.WriteFile(filename, []byte(netrc), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			// WriteFile unterliegt der umask
+			if err := os.Chmod(filename, tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			os.Setenv("NETRC", filename)
+			defer os.Unsetenv("NETRC")
+			_, password, err := netrcLookup("")
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, erwartet %q", err, tt.err)
+			}
+			if password != tt.password {
+				t.Errorf("password = %q, erwartet %q", password, tt.password)
+			}
+		})
+	}
+}
+
+func TestNetrcLookupMissing(t *testing.T) {
+	os.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+	defer os.Unsetenv("NETRC")
+	if login, password, err := netrcLookup(""); login != "" || password != "" || err != nil {
+		t.Errorf("netrcLookup = %q, %q, %v, erwartet nichts", login, password, err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeDate - "-3" steht für vor drei Tagen
+var relativeDate = regexp.MustCompile(`^-(\d+)$`)
+
+// negativeDate - Parameter wie -3 oder -7..-1, die mit - beginnen,
+// aber keine Optionen sind
+var negativeDate = regexp.MustCompile(`^-\d`)
+
+// numericDate - Parameter nur aus Ziffern und -, die keine Ausgabe sein
+// können. Lassen sie sich nicht lesen, ist das ein Fehler.
+var numericDate = regexp.MustCompile(`^[-0-9]+$`)
+
+// dateShaped - arg ist als Datum gemeint, z.B. 20201332 oder 2020-10-01..x
+func dateShaped(arg string) bool {
+	return numericDate.MatchString(arg) || strings.Contains(arg, "..")
+}
+
+// wantedDate - Ein Datum für die API ("latest" oder YYYYMMDD)
+type wantedDate struct {
+	date string
+	// inRange - Das Datum stammt aus einem Bereich. Fehlt die Ausgabe
+	// (Sonntag, Feiertag), wird es übersprungen.
+	inRange bool
+}
+
+// expandDate - Wandelt eine Datumsangabe in die Daten für die API um.
+// Erlaubt sind latest, today, yesterday, -N (vor N Tagen),
+// YYYYMMDD, YYYY-MM-DD und Bereiche VON..BIS aus diesen Angaben.
+func expandDate(arg string, now time.Time) ([]wantedDate, error) {
+	if arg == "latest" {
+		return []wantedDate{{date: "latest"}}, nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if parts := strings.SplitN(arg, "..", 2); len(parts) == 2 {
+		from, err := parseDay(parts[0], today)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseDay(parts[1], today)
+		if err != nil {
+			return nil, err
+		}
+		if to.Before(from) {
+			return nil, fmt.Errorf("ungültiger Bereich %s: Ende vor Anfang", arg)
+		}
+		var dates []wantedDate
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			dates = append(dates, wantedDate{day.Format("20060102"), true})
+		}
+		return dates, nil
+	}
+	day, err := parseDay(arg, today)
+	if err != nil {
+		return nil, err
+	}
+	return []wantedDate{{date: day.Format("20060102")}}, nil
+}
+
+// parseDay - Ein einzelner Tag relativ zu today
+func parseDay(arg string, today time.Time) (time.Time, error) {
+	switch arg {
+	case "today", "heute":
+		return today, nil
+	case "yesterday", "gestern":
+		return today.AddDate(0, 0, -1), nil
+	}
+	if m := relativeDate.FindStringSubmatch(arg); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return today.AddDate(0, 0, -days), nil
+	}
+	for _, layout := range []string{"20060102", "2006-01-02"} {
+		if day, err := time.Parse(layout, arg); err == nil {
+			return day, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ungültiges Datum %s", arg)
+}
@@ -0,0 +1,158 @@
+package epaper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultCacheDir - The default location of the HTTP cache
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azdl", "http"), nil
+}
+
+// setCacheVersion - Die Version der Ausgabe, auf die sich die folgenden
+// Requests beziehen. 0 heißt unbekannt.
+func (c *Client) setCacheVersion(version int) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	c.cacheVersion = version
+}
+
+// cacheFile - Die Datei für url in der Version der Ausgabe
+func (c *Client) cacheFile(url string, version int) string {
+	sum := sha256.Sum256([]byte(url + "#" + strconv.Itoa(version)))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Cache, key[:2], key)
+}
+
+// cached - Beantwortet GET Requests aus dem Cache. Gehört der Request
+// zu einer bekannten Version der Ausgabe, ändert sich die Antwort nicht
+// und der Cache wird zuerst gefragt. Sonst wird geladen und die Antwort
+// nur für den Offline Betrieb gespeichert.
+func (c *Client) cached(request *http.Request, load func(*http.Request) (*http.Response, []byte, error)) (*http.Response, []byte, error) {
+	c.versionMu.RLock()
+	version := c.cacheVersion
+	c.versionMu.RUnlock()
+	filename := c.cacheFile(request.URL.String(), version)
+	if c.Offline || version != 0 {
+		if response, data, err := readCacheEntry(filename, request); err == nil {
+			// Die Änderungszeit dient prune als letzte Verwendung
+			now := time.Now()
+			os.Chtimes(filename, now, now)
+			return response, data, checkStatus(response, data)
+		}
+		if c.Offline {
+			return nil, nil, fmt.Errorf("%s %s: %w", request.Method, request.URL, ErrNotCached)
+		}
+	}
+
+	response, data, err := load(request)
+	// Fehlende Bilder sind auch eine Antwort, 304 auf eine bedingte
+	// Anfrage dagegen nicht
+	if response != nil && response.StatusCode != http.StatusNotModified &&
+		(err == nil || errors.Is(err, ErrNotFound)) {
+		if werr := writeCacheEntry(filename, response.StatusCode, data); werr != nil {
+			c.logf("Cache %s nicht schreibbar: %v", c.Cache, werr)
+		}
+	}
+	return response, data, err
+}
+
+// readCacheEntry - Ein Eintrag besteht aus dem HTTP Status in der
+// ersten Zeile und dem Body
+func readCacheEntry(filename string, request *http.Request) (*http.Response, []byte, error) {
+	entry, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := bytes.IndexByte(entry, '\n')
+	if i < 0 {
+		return nil, nil, errors.New("ungültiger Cache Eintrag")
+	}
+	status, err := strconv.Atoi(string(entry[:i]))
+	if err != nil {
+		return nil, nil, err
+	}
+	data := entry[i+1:]
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Header:        http.Header{},
+		ContentLength: int64(len(data)),
+		Request:       request,
+	}, data, nil
+}
+
+func writeCacheEntry(filename string, status int, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename, 0600, func(w io.Writer) error {
+		if _, err := fmt.Fprintf(w, "%d\n", status); err != nil {
+			return err
+		}
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// PruneCache - Removes the entries of the HTTP cache in dir that were
+// not used for maxAge, then the least recently used ones until the cache
+// is no larger than maxSize bytes. Zero disables a limit.
+func PruneCache(dir string, maxAge time.Duration, maxSize int64) (removed int, freed int64, err error) {
+	type entry struct {
+		path string
+		info os.FileInfo
+	}
+	var entries []entry
+	var size int64
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			entries = append(entries, entry{path, info})
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	// Die ältesten zuerst
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].info.ModTime().Before(entries[j].info.ModTime())
+	})
+	for _, e := range entries {
+		tooOld := maxAge > 0 && time.Since(e.info.ModTime()) > maxAge
+		tooBig := maxSize > 0 && size > maxSize
+		if !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += e.info.Size()
+		size -= e.info.Size()
+	}
+	return removed, freed, nil
+}
@@ -0,0 +1,85 @@
+package epaper
+
+import (
+	"fmt"
+
+	"golang.org/x/net/html"
+	"hradek.net/azdl/templates"
+)
+
+// Artikel "reinigen": Texte mit Auszeichnungen werden zu XHTML,
+// im Titel werden nur die Entities ersetzt
+func (c *Client) clean(artikel *Article) {
+	report := func(construct string) {
+		c.unknownHTML("Artikel "+artikel.ID, construct)
+	}
+	artikel.Text = xhtml(artikel.Text, report)
+	artikel.Underline = xhtml(artikel.Underline, report)
+	artikel.Author = xhtml(artikel.Author, report)
+	for i := range artikel.Pictures {
+		artikel.Pictures[i].Description = xhtml(artikel.Pictures[i].Description, report)
+	}
+	artikel.Title = html.UnescapeString(artikel.Title)
+}
+
+// unknownHTML - Meldet jedes unbekannte Element, Attribut und jede
+// unbekannte Klasse einmal, damit neue Auszeichnungen des Verlags
+// auffallen
+func (c *Client) unknownHTML(source, construct string) {
+	c.unknownMu.Lock()
+	defer c.unknownMu.Unlock()
+	if c.unknown[construct] {
+		return
+	}
+	if c.unknown == nil {
+		c.unknown = map[string]bool{}
+	}
+	c.unknown[construct] = true
+	c.logf("Unbekanntes HTML in %s entfernt: %s", source, construct)
+}
+
+// Erstellen eines Alternativtitels
+func (c *Client) cheapExerpt(artikel *Article) string {
+	// Den vorhandenen Titel nehmen
+	if artikel.Title != "" {
+		return html.UnescapeString(artikel.Title)
+	}
+	// Sonst, wenn kein Artikeltext vorhanden
+	txt := artikel.Text
+	if txt == "" {
+		// Wenn kein Bild vorhandeen is
+		if len(artikel.Pictures) < 1 {
+			return "Leerer Artikel"
+		}
+		// Und keine Bildbeschreibung fürs erste Bild
+		txt = artikel.Pictures[0].Description
+		if txt == "" {
+			// Dann generiere einen Bildnamen aus den Dimensionen des Bildes
+			// Bekannte Dimensionen (DAX, Wetter, Festgeld...)
+			// werden durch feste Namen ersetzt. Siehe templates.go
+			bildname := templates.Bildnamen.Replace(
+				fmt.Sprintf("Bild %d × %d", artikel.Width, artikel.Height))
+			c.logf("%s %s", artikel.Pictures[0].ID, bildname)
+			return bildname
+		}
+	}
+	// Aufbereiten des Textes
+	// - Erstes Tag entfernen
+	// - Ab dem ersten </p> alles abschneiden
+	// - "Locationmark" entfernen
+	// - Alle Tags löschen
+	txt = templates.RemoveTags.ReplaceAllString(
+		templates.RemoveLocationMark.ReplaceAllString(
+			templates.CutOffParagraphs.ReplaceAllString(
+				templates.KillFirstTag.ReplaceAllString(txt,
+					``),
+				``),
+			``),
+		``)
+	txt = html.UnescapeString(txt)
+	// Texte über 40 Zeichen länge kürzen
+	if len(txt) > 40 {
+		txt = templates.Shorten.ReplaceAllString(txt, `$1…`)
+	}
+	return txt
+}
@@ -0,0 +1,387 @@
+// Package epaper downloads releases of the newspapers published
+// on epaper.zeitungsverlag-aachen.de and converts them to ePubs.
+package epaper
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BaseURL - The ePaper's base URL
+const BaseURL = "https://epaper.zeitungsverlag-aachen.de/2.0"
+
+var standardHeaders = map[string]string{
+	"User-Agent":   "Stephan Hradeks AZAN Epub Builder v0.0",
+	"Content-Type": "application/json;charset=utf-8",
+	"Accept":       "application/json",
+}
+
+// Client - The ePaper client holding the session and the known editions
+type Client struct {
+	C            *http.Client
+	Header       http.Header
+	Impressum    string
+	Ausgabe      string
+	BaseURL      string
+	NewspaperURL string
+	Ed2Name      map[string]string
+	Name2Ed      map[string]string
+	Editions     map[string]Edition
+	// Log receives diagnostic messages. nil discards them.
+	Log *log.Logger
+	// Progress is called whenever a page has been loaded. May be nil.
+	// It may be called from several goroutines at once.
+	Progress func(page, pages int)
+	// Concurrency limits the number of parallel downloads
+	Concurrency int
+	// Retry determines how failed requests are repeated
+	Retry RetryPolicy
+	// InfoCache keeps the last editions and imprint read successfully.
+	// They are used when the app bundle cannot be found or read.
+	// NewClient sets it to DefaultInfoCache.
+	InfoCache string
+	// OutputDir is the directory the ePubs are written to
+	OutputDir string
+	// Filename is the template for the names of the ePubs below
+	// OutputDir, see FileInfo. Empty means DefaultFilename.
+	Filename string
+	// CSS replaces the stylesheet of the ePubs if not empty
+	CSS string
+	// SkipPages lists page titles (e.g. "SPORT") whose articles are left out
+	SkipPages []string
+	// StateFile records the version of every release written, so
+	// unchanged releases are skipped. Empty disables this.
+	// See DefaultStateFile.
+	StateFile string
+	// Force rebuilds releases even if they are unchanged, without
+	// reusing anything from the previous ePub
+	Force bool
+	// Validate checks every ePub with epubcheck before it replaces the
+	// file. If problems are found, CreateAzanEpub returns an *InvalidError
+	// and leaves both the file and the StateFile unchanged.
+	Validate bool
+	// Cache is the directory of the HTTP cache. Empty disables it.
+	// See DefaultCacheDir and PruneCache.
+	Cache string
+	// Offline answers all requests from the Cache. Use NewOfflineClient.
+	Offline bool
+	// TokenCache is the file the session is kept in between runs.
+	// Empty disables the cache. See DefaultTokenCache.
+	TokenCache string
+
+	credentials *azanlogin
+	shared      shared
+	headerMu    sync.RWMutex
+	loginMu     sync.Mutex
+	// cacheVersion - Die Version der Ausgabe für den Cache
+	cacheVersion int
+	versionMu    sync.RWMutex
+	// unknown - Das bereits gemeldete unbekannte HTML
+	unknown   map[string]bool
+	unknownMu sync.Mutex
+}
+
+type azanlogin struct {
+	Login string `json:"login"`
+	Pass  string `json:"password"`
+}
+
+type azanauthorization struct {
+	Authorization string `json:"authorizationHeader"`
+	Error         string `json:"error"`
+}
+
+// NewClient - Creates a client and loads the imprint and the editions
+func NewClient(ctx context.Context) (*Client, error) {
+	return NewClientWithTransport(ctx, nil)
+}
+
+// NewClientWithTransport - Like NewClient, but all requests including
+// those for the editions use transport, e.g. a RecordTransport or a
+// ReplayTransport. Nil means http.DefaultTransport.
+func NewClientWithTransport(ctx context.Context, transport http.RoundTripper) (*Client, error) {
+	myclient := newClient()
+	myclient.C.Transport = transport
+
+	// Impressum und Editionen laden
+	if err := myclient.loadInfos(ctx); err != nil {
+		return nil, err
+	}
+
+	return myclient, nil
+}
+
+// NewOfflineClient - Creates a client that answers all requests from
+// the HTTP cache in dir. The editions are taken from the InfoCache.
+func NewOfflineClient(ctx context.Context, dir string) (*Client, error) {
+	myclient := newClient()
+	myclient.Cache = dir
+	myclient.Offline = true
+	if err := myclient.loadInfos(ctx); err != nil {
+		return nil, err
+	}
+	return myclient, nil
+}
+
+// newClient - Ein Client mit den Vorgaben
+func newClient() *Client {
+	// Erstelle HTTP client
+	myclient := Client{
+		C: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		Header:      http.Header{},
+		BaseURL:     BaseURL,
+		Ed2Name:     make(map[string]string),
+		Name2Ed:     make(map[string]string),
+		Editions:    make(map[string]Edition),
+		Concurrency: DefaultConcurrency,
+		Retry:       DefaultRetryPolicy,
+	}
+	for k, v := range standardHeaders {
+		myclient.Header.Set(k, v)
+	}
+	myclient.InfoCache, _ = DefaultInfoCache()
+	return &myclient
+}
+
+// SelectEdition - Selects the edition (code or title) the following
+// downloads refer to. The session stays valid for all editions.
+func (c *Client) SelectEdition(azanAusgabe string) error {
+	edTitel := c.Ed2Name[azanAusgabe]
+	edition := c.Name2Ed[azanAusgabe]
+	if edTitel != "" {
+		edition = azanAusgabe
+	} else if edition != "" {
+		edTitel = azanAusgabe
+	} else {
+		return fmt.Errorf("Es gibt keine Ausgabe %s der Aachener Zeitung", azanAusgabe)
+	}
+	c.NewspaperURL = c.BaseURL + "/api/" + edition
+	c.Ausgabe = edition
+	return nil
+}
+
+// Login - Selects the edition (code or title) and logs in.
+// A session found in the TokenCache is reused without logging in.
+// The credentials are kept to log in again once the session expires.
+func (c *Client) Login(ctx context.Context, azanAusgabe, user, pass string) error {
+	if err := c.SelectEdition(azanAusgabe); err != nil {
+		return err
+	}
+	c.credentials = &azanlogin{
+		Login: user,
+		Pass:  pass,
+	}
+
+	// Offline wird keine Anmeldung gebraucht
+	if c.Offline {
+		return nil
+	}
+
+	// Eine gespeicherte Anmeldung wird ungeprüft übernommen.
+	// Lehnt die API sie ab, meldet sich dann neu an.
+	if s, ok := c.cachedSession(); ok {
+		c.logf("Verwende Anmeldung vom %s", s.Acquired.Local().Format("02.01.2006 15:04"))
+		c.setAuthorization(s.Authorization)
+		return nil
+	}
+	return c.login(ctx)
+}
+
+// login - Meldet sich mit den gespeicherten Zugangsdaten an
+func (c *Client) login(ctx context.Context) error {
+	// prepare for login
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(c.credentials); err != nil {
+		return err
+	}
+
+	// Log in
+	request, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/user/login", buf)
+	if err != nil {
+		return err
+	}
+
+	auth := new(azanauthorization)
+	// Make login request. Ein abgelehnter Login darf
+	// nicht zu einer erneuten Anmeldung führen.
+	response, data, err := c.doRetry(request)
+	if err == nil {
+		err = decodeJSON(response, data, auth)
+	}
+	if err != nil {
+		// Die Fehlermeldung der API bevorzugen
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && errors.Is(err, ErrUnauthorized) &&
+			json.Unmarshal([]byte(apiErr.Snippet), auth) == nil && auth.Error != "" {
+			return fmt.Errorf("Anmeldung fehlgeschlagen: %s: %w", auth.Error, ErrUnauthorized)
+		}
+		return err
+	}
+	if auth.Error != "" {
+		return fmt.Errorf("Anmeldung fehlgeschlagen: %s: %w", auth.Error, ErrUnauthorized)
+	}
+	if auth.Authorization == "" {
+		return fmt.Errorf("Anmeldung fehlgeschlagen: keine Autorisierung erhalten: %w", ErrMalformed)
+	}
+
+	// Set authorization
+	c.setAuthorization(auth.Authorization)
+	c.storeSession(auth.Authorization)
+	return nil
+}
+
+func (c *Client) setAuthorization(authorization string) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
+	c.Header.Set("Authorization", authorization)
+}
+
+// relogin - Meldet sich erneut an, nachdem ein Request mit der
+// Autorisierung used abgelehnt wurde. Haben parallele Requests
+// die Anmeldung bereits erneuert, wird nur die neue verwendet.
+func (c *Client) relogin(ctx context.Context, used string) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	if c.header().Get("Authorization") != used {
+		return nil
+	}
+	c.logf("Sitzung abgelaufen, melde erneut an")
+	return c.login(ctx)
+}
+
+// header - Eine Kopie der aktuellen Header
+func (c *Client) header() http.Header {
+	c.headerMu.RLock()
+	defer c.headerMu.RUnlock()
+	return c.Header.Clone()
+}
+
+// do - Wie doOnline, beantwortet GET Requests aber aus dem Cache
+func (c *Client) do(request *http.Request) (*http.Response, []byte, error) {
+	if c.Cache != "" && request.Method == "GET" {
+		return c.cached(request, c.doOnline)
+	}
+	if c.Offline {
+		return nil, nil, fmt.Errorf("%s %s: %w", request.Method, request.URL, ErrNotCached)
+	}
+	return c.doOnline(request)
+}
+
+// doOnline - Wie doRetry, meldet sich aber nach einer Ablehnung (401/403)
+// einmal erneut an und wiederholt den Request
+func (c *Client) doOnline(request *http.Request) (*http.Response, []byte, error) {
+	response, data, err := c.doRetry(request)
+	if c.credentials == nil || !errors.Is(err, ErrUnauthorized) {
+		return response, data, err
+	}
+	if err := c.relogin(request.Context(), request.Header.Get("Authorization")); err != nil {
+		return nil, nil, err
+	}
+	return c.doRetry(request)
+}
+
+func (c *Client) logf(format string, v ...interface{}) {
+	if c.Log != nil {
+		c.Log.Printf(format, v...)
+	}
+}
+
+// Raw - Loads the API response for relativeURL (e.g. "latest" or
+// "20200821/3") without decoding it
+func (c *Client) Raw(ctx context.Context, relativeURL string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", c.NewspaperURL+"/"+relativeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, data, err := c.do(request)
+	return data, err
+}
+
+func (c *Client) getJSON(ctx context.Context, relativeURL string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", c.NewspaperURL+"/"+relativeURL, nil)
+	if err != nil {
+		return err
+	}
+	return c.fetchJSON(request, target)
+}
+
+func (c *Client) fetchJSON(request *http.Request, target interface{}) error {
+	response, data, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(response, data, target)
+}
+
+func decodeJSON(response *http.Response, data []byte, target interface{}) error {
+	// parse the page data
+	if err := json.Unmarshal(data, target); err != nil {
+		return newAPIError(ErrMalformed, response, data, err)
+	}
+	return nil
+}
+
+// download - Ein geladenes Bild
+type download struct {
+	size       int64
+	data       []byte
+	validators validators
+}
+
+func (c *Client) loadFromURL(ctx context.Context, relativeURL string) (*download, error) {
+	return c.loadIfModified(ctx, relativeURL, nil)
+}
+
+// loadIfModified - Wie loadFromURL. Ist previous eine frühere Antwort,
+// wird sie geliefert, wenn der Server sie als unverändert meldet.
+func (c *Client) loadIfModified(ctx context.Context, relativeURL string, previous *download) (*download, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", c.NewspaperURL+"/"+relativeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		previous.validators.set(request)
+	}
+	response, data, err := c.do(request)
+	if errors.Is(err, ErrNotFound) {
+		// Fehlende Bilder werden im Artikel vermerkt
+		c.logf("%v", err)
+		return &download{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && response.StatusCode == http.StatusNotModified {
+		return previous, nil
+	}
+	size := response.ContentLength
+	if 0 == size {
+		return &download{}, nil
+	}
+	return &download{size, data, responseValidators(response)}, nil
+}
+
+// save - Schreibt den Download ins ePub, sofern er nicht leer ist
+func (d *download) save(zipWriter *zip.Writer, filename string) (int64, error) {
+	if 0 == d.size {
+		return 0, nil
+	}
+	f, err := zipWriter.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = f.Write(d.data); err != nil {
+		return 0, err
+	}
+	return d.size, nil
+}
@@ -0,0 +1,594 @@
+// Package epapertest provides a fake ePaper API for tests. It serves the
+// start page, the app bundle, the login and all API requests from fixture
+// data and can inject faults, so the whole download runs without network.
+package epapertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix - Der Pfad der App auf dem Server, wie bei epaper.BaseURL
+const Prefix = "/2.0"
+
+// Edition - An edition listed in the app bundle
+type Edition struct {
+	Paper string // az-d
+	Title string // Dürener Zeitung
+	Brand string // az
+}
+
+// Issue - A release of an edition
+type Issue struct {
+	Paper        string
+	Title        string
+	Brand        string
+	Date         int // 20060102
+	Version      int
+	Subscription bool
+	Bought       bool
+	Pages        []Page
+	// PageTitles replaces the page titles of the release if not nil
+	PageTitles []string
+}
+
+// Page - A page of a release. Every article gets an element on the page,
+// linked to the previous and next article of the release.
+type Page struct {
+	Title    string
+	Free     bool
+	Articles []*Article
+	// Ad adds an advertisement element, which is no article
+	Ad bool
+}
+
+// Article - An article. The same *Article on several pages is
+// a duplicate, as the API delivers it for every page.
+type Article struct {
+	ID        string
+	Title     string
+	Author    string
+	Underline string
+	Headline  string
+	Location  string
+	Text      string
+	Pictures  []*Picture
+}
+
+// Picture - A picture of an article. Nil Data answers with 404.
+type Picture struct {
+	ID          string
+	Description string
+	Data        []byte
+}
+
+// Fault - A fault injected into the answers for the requests whose
+// path (without Prefix) matches Pattern, e.g. `^/api/az-d/20201002/1$`
+type Fault struct {
+	Pattern    string
+	Status     int           // answer with this HTTP status
+	Body       string        // answer with this body, e.g. invalid JSON
+	RetryAfter string        // Retry-After header
+	Delay      time.Duration // wait before answering
+	// Times limits the fault to the first requests, 0 means always
+	Times int
+
+	re *regexp.Regexp
+}
+
+// Server - The fake ePaper API. Change the fixtures only while no
+// client is running.
+type Server struct {
+	*httptest.Server
+
+	User     string
+	Password string
+	Editions []Edition
+	Imprint  string
+	// Issues - Die Ausgaben je Kürzel und Datum, z.B. "az-d/20201002"
+	Issues map[string]*Issue
+	// Latest - Das Datum der neuesten Ausgabe
+	Latest int
+	// TitleImage - Das Titelbild jeder Ausgabe
+	TitleImage []byte
+
+	mu       sync.Mutex
+	token    int
+	faults   []*Fault
+	requests []string
+	// notModified - Die Requests, die mit 304 beantwortet wurden
+	notModified []string
+}
+
+// JPEG - Ein kleines Bild für die Fixtures
+var JPEG = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00\xff\xd9")
+
+// NewServer - Starts a fake API with two editions (az-d and an-a1) and
+// their releases of 2020-10-02. The login is user/secret.
+func NewServer() *Server {
+	s := &Server{
+		User:     "user",
+		Password: "secret",
+		Editions: []Edition{
+			{"az-d", "Dürener Zeitung", "az"},
+			{"an-a1", "Aachener Nachrichten Stadt", "an"},
+		},
+		Imprint:    "<p>Zeitungsverlag Aachen GmbH<br>Dresdener Straße 3</p>",
+		Issues:     map[string]*Issue{},
+		Latest:     20201002,
+		TitleImage: JPEG,
+	}
+	for _, edition := range s.Editions {
+		s.AddIssue(DefaultIssue(edition, 20201002))
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// DefaultIssue - A release with three pages: a title page with two
+// articles, a page with an article that is repeated on the third, the
+// SPORT page, which also has an article without title and pictures.
+func DefaultIssue(edition Edition, date int) *Issue {
+	mantel := &Article{
+		ID:       "1001",
+		Title:    "Corona-Hotspot Innenraum",
+		Author:   "Anna Autorin",
+		Location: "Aachen",
+		Text:     "<p>An der frischen Luft <b>steckt</b> man sich kaum an.</p><p>Zweiter Absatz &amp; Schluss</p>",
+		Pictures: []*Picture{{ID: "2094290259_e7c39b54a0.irprodgera_i14u8q", Description: "Ein Bild", Data: JPEG}},
+	}
+	// Lokale Artikel gibt es nur in einer Ausgabe
+	lokal := &Article{
+		ID:    "1002-" + edition.Paper,
+		Title: "Neues aus " + edition.Title,
+		Text:  "<p>Lokales</p>",
+	}
+	doppelt := &Article{
+		ID:       "1003",
+		Title:    "Der Artikel steht zweimal",
+		Text:     "<p>Einmal hier und einmal auf der Sportseite.</p>",
+		Pictures: []*Picture{{ID: "2094290260_f8d40c65b1.irprodgera_j25v9r", Data: JPEG}},
+	}
+	ohneTitel := &Article{
+		ID: "1004",
+		// HTML, wie es die API liefert, aber kein XHTML
+		Text: `<p><b class="ortsmarke">Eschweiler </b>Dieser Artikel hat keinen Titel und keine Bilder.<br>` +
+			`Er ist &auml;lter&nbsp;als gedacht<hr><p onclick="track()" style="color:red">Unvollst&auml;ndig` +
+			`<img src="https://tracker.example/pixel.gif"><script>track()</script><font class="neu">`,
+	}
+	return &Issue{
+		Paper:        edition.Paper,
+		Title:        edition.Title,
+		Brand:        edition.Brand,
+		Date:         date,
+		Version:      1,
+		Subscription: true,
+		Pages: []Page{
+			{Title: "TITELSEITE", Articles: []*Article{mantel, lokal}, Ad: true},
+			{Title: "POLITIK", Articles: []*Article{doppelt}},
+			{Title: "SPORT", Articles: []*Article{doppelt, ohneTitel}},
+		},
+	}
+}
+
+// AddIssue - Adds or replaces a release
+func (s *Server) AddIssue(issue *Issue) {
+	s.Issues[issue.Paper+"/"+strconv.Itoa(issue.Date)] = issue
+}
+
+// BaseURL - The URL to use as epaper.Client.BaseURL
+func (s *Server) BaseURL() string {
+	return s.URL + Prefix
+}
+
+// Transport - Sends all requests to the fake server, whatever host they
+// are addressed to. Use it with epaper.NewClientWithTransport.
+func (s *Server) Transport() http.RoundTripper {
+	target, _ := url.Parse(s.URL)
+	return roundTripper(func(request *http.Request) (*http.Response, error) {
+		request = request.Clone(request.Context())
+		request.URL.Scheme = target.Scheme
+		request.URL.Host = target.Host
+		request.Host = target.Host
+		return s.Client().Transport.RoundTrip(request)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// AddFault - Injects a fault. It panics if the pattern is invalid.
+func (s *Server) AddFault(f Fault) {
+	f.re = regexp.MustCompile(f.Pattern)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ExpireSessions - Invalidates all authorizations handed out so far,
+// so the next API request is answered with 401
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token++
+}
+
+// Requests - The number of requests whose path (without Prefix)
+// matches pattern
+func (s *Server) Requests(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, path := range s.requests {
+		if re.MatchString(path) {
+			n++
+		}
+	}
+	return n
+}
+
+// NotModified - The number of requests whose path matches pattern
+// that were answered with 304 Not Modified
+func (s *Server) NotModified(pattern string) int {
+	re := regexp.MustCompile(pattern)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, path := range s.notModified {
+		if re.MatchString(path) {
+			n++
+		}
+	}
+	return n
+}
+
+// ResetRequests - Forgets the requests counted so far
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.notModified = nil
+}
+
+func (s *Server) authorization() string {
+	return "Bearer token-" + strconv.Itoa(s.token)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	s.mu.Lock()
+	s.requests = append(s.requests, path)
+	var fault *Fault
+	for _, f := range s.faults {
+		if f.re.MatchString(path) && f.Times >= 0 {
+			fault = f
+			if f.Times > 0 {
+				if f.Times--; f.Times == 0 {
+					// Verbraucht
+					f.Times = -1
+				}
+			}
+			break
+		}
+	}
+	authorization := s.authorization()
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.RetryAfter != "" {
+			w.Header().Set("Retry-After", fault.RetryAfter)
+		}
+		if fault.Status != 0 {
+			w.WriteHeader(fault.Status)
+			fmt.Fprint(w, fault.Body)
+			return
+		}
+		if fault.Body != "" {
+			fmt.Fprint(w, fault.Body)
+			return
+		}
+	}
+
+	switch {
+	case path == "/" || path == "":
+		fmt.Fprintf(w, `<!DOCTYPE html><html><head><script src="js/app-1a2b3c4d.js"></script></head><body></body></html>`)
+	case path == "/js/app-1a2b3c4d.js":
+		s.serveBundle(w)
+	case path == "/api/user/login" && r.Method == "POST":
+		s.serveLogin(w, r, authorization)
+	case strings.HasPrefix(path, "/api/"):
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"nicht angemeldet"}`)
+			return
+		}
+		s.serveAPI(w, r, strings.Split(strings.TrimPrefix(path, "/api/"), "/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveBundle - Ein App Bundle wie das echte: Die Editionen sind
+// Objektliterale, das Impressum ein String.
+func (s *Server) serveBundle(w http.ResponseWriter) {
+	fmt.Fprint(w, "!function(){\"use strict\";var e=[")
+	for i, edition := range s.Editions {
+		if i > 0 {
+			fmt.Fprint(w, ",")
+		}
+		fmt.Fprintf(w, "{paper:%s,title:%s,brand:%s,active:!0}", jsString(edition.Paper), jsString(edition.Title), jsString(edition.Brand))
+	}
+	fmt.Fprintf(w, "];var t=%s;/* Ende */}();\n", jsString("<h1>Impressum</h1>"+s.Imprint))
+}
+
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func (s *Server) serveLogin(w http.ResponseWriter, r *http.Request, authorization string) {
+	var login struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if login.Login != s.User || login.Password != s.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"Benutzername oder Passwort falsch"}`)
+		return
+	}
+	writeJSON(w, map[string]string{"authorizationHeader": authorization})
+}
+
+// serveAPI - /api/{edition}/{date}[/{page}[/{article}|/big|/{picture}/jpg]]
+// Artikel und Bilder haben ein ETag und werden bedingt ausgeliefert.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 2 {
+		writeNotFound(w)
+		return
+	}
+	date := parts[1]
+	if date == "latest" {
+		date = strconv.Itoa(s.Latest)
+	}
+	issue := s.Issues[parts[0]+"/"+date]
+	if issue == nil {
+		// Wie die echte API: eine leere Ausgabe
+		writeJSON(w, map[string]interface{}{"paper": parts[0], "date": 0, "numberOfPages": 0})
+		return
+	}
+	if len(parts) == 2 {
+		writeJSON(w, issue.json())
+		return
+	}
+	index, err := strconv.Atoi(parts[2])
+	if err != nil || index < 0 || index >= len(issue.Pages) {
+		writeNotFound(w)
+		return
+	}
+	switch {
+	case len(parts) == 3:
+		writeJSON(w, issue.pageJSON(index))
+	case len(parts) == 4 && parts[3] == "big":
+		if index != 0 || s.TitleImage == nil {
+			writeNotFound(w)
+			return
+		}
+		s.writeConditional(w, r, "image/jpeg", s.TitleImage)
+	case len(parts) == 4:
+		article := issue.articleJSON(index, parts[3])
+		if article == nil {
+			writeNotFound(w)
+			return
+		}
+		data, _ := json.Marshal(article)
+		s.writeConditional(w, r, "application/json", data)
+	case len(parts) == 5 && parts[4] == "jpg":
+		for _, a := range issue.Pages[index].Articles {
+			for _, p := range a.Pictures {
+				if p.ID == parts[3] && p.Data != nil {
+					s.writeConditional(w, r, "image/jpeg", p.Data)
+					return
+				}
+			}
+		}
+		writeNotFound(w)
+	default:
+		writeNotFound(w)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeConditional - Antwortet mit 304, wenn If-None-Match das ETag
+// von data nennt
+func (s *Server) writeConditional(w http.ResponseWriter, r *http.Request, contentType string, data []byte) {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		s.mu.Lock()
+		s.notModified = append(s.notModified, strings.TrimPrefix(r.URL.Path, Prefix))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	writeJSON(w, map[string]string{"error": "not found"})
+}
+
+func (issue *Issue) json() map[string]interface{} {
+	titles := make([]string, len(issue.Pages))
+	for i, page := range issue.Pages {
+		titles[i] = page.Title
+	}
+	if issue.PageTitles != nil {
+		titles = issue.PageTitles
+	}
+	return map[string]interface{}{
+		"paper":         issue.Paper,
+		"title":         issue.Title,
+		"date":          issue.Date,
+		"brand":         issue.Brand,
+		"numberOfPages": len(issue.Pages),
+		"pageTitles":    titles,
+		"subscription":  issue.Subscription,
+		"bought":        issue.Bought,
+		"version":       issue.Version,
+	}
+}
+
+func (issue *Issue) pageRef(index int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     fmt.Sprintf("%d-%d", issue.Date, 47208377+index),
+		"index":  index,
+		"number": index + 1,
+		"title":  issue.Pages[index].Title,
+	}
+}
+
+func (issue *Issue) paperRef(index int) map[string]interface{} {
+	return map[string]interface{}{
+		"paper": issue.Paper,
+		"date":  strconv.Itoa(issue.Date),
+		"title": issue.Title,
+		"page":  issue.pageRef(index),
+	}
+}
+
+// placement - Ein Artikel auf einer Seite
+type placement struct {
+	page    int
+	article *Article
+}
+
+// placements - Alle Artikel der Ausgabe in der Reihenfolge, in der sie
+// über prev und next verkettet sind
+func (issue *Issue) placements() []placement {
+	var all []placement
+	for i, page := range issue.Pages {
+		for _, a := range page.Articles {
+			all = append(all, placement{i, a})
+		}
+	}
+	return all
+}
+
+// box - Die Position des n-ten Elements einer Seite
+func box(n int) map[string]interface{} {
+	return map[string]interface{}{
+		"xStart": 12,
+		"xEnd":   283,
+		"yStart": 45 + 100*n,
+		"yEnd":   140 + 100*n,
+		"area":   271 * 95,
+		"width":  620,
+		"height": 1024,
+	}
+}
+
+func (issue *Issue) pageJSON(index int) map[string]interface{} {
+	page := issue.Pages[index]
+	var elements []map[string]interface{}
+	for n, a := range page.Articles {
+		element := box(n)
+		element["id"] = a.ID
+		element["type"] = "article"
+		element["title"] = a.Title
+		element["author"] = a.Author
+		element["underline"] = a.Underline
+		element["headline"] = a.Headline
+		element["location"] = a.Location
+		elements = append(elements, element)
+	}
+	if page.Ad {
+		ad := box(len(page.Articles))
+		ad["id"] = fmt.Sprintf("ad-%d", index)
+		ad["type"] = "ad"
+		elements = append(elements, ad)
+	}
+	seite := issue.pageRef(index)
+	seite["width"] = 351
+	seite["height"] = 506
+	seite["elements"] = elements
+	seite["free"] = page.Free
+	return seite
+}
+
+func (issue *Issue) articleJSON(index int, id string) map[string]interface{} {
+	all := issue.placements()
+	for i, p := range all {
+		if p.page != index || p.article.ID != id {
+			continue
+		}
+		a := p.article
+		link := func(j int) map[string]interface{} {
+			if j < 0 || j >= len(all) {
+				return map[string]interface{}{"id": "", "paper": map[string]interface{}{}}
+			}
+			return map[string]interface{}{"id": all[j].article.ID, "paper": issue.paperRef(all[j].page)}
+		}
+		var pictures []map[string]interface{}
+		for n, picture := range a.Pictures {
+			pj := box(n)
+			pj["id"] = picture.ID
+			pj["type"] = "picture"
+			pj["description"] = picture.Description
+			pictures = append(pictures, pj)
+		}
+		article := box(0)
+		for k, v := range map[string]interface{}{
+			"id":         a.ID,
+			"type":       "article",
+			"title":      a.Title,
+			"author":     a.Author,
+			"underline":  a.Underline,
+			"headline":   a.Headline,
+			"location":   a.Location,
+			"pictures":   pictures,
+			"paper":      issue.paperRef(index),
+			"text":       a.Text,
+			"sociallink": "https://epaper.zeitungsverlag-aachen.de/2.0/article/" + a.ID,
+			"print":      "https://epaper.zeitungsverlag-aachen.de/2.0/article/" + a.ID,
+			"wordcount":  len(strings.Fields(a.Text)),
+			"prev":       link(i - 1),
+			"next":       link(i + 1),
+		} {
+			article[k] = v
+		}
+		return article
+	}
+	return nil
+}
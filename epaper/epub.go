@@ -0,0 +1,586 @@
+package epaper
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+	"hradek.net/azdl/epubcheck"
+	"hradek.net/azdl/templates"
+)
+
+// Issue - Loads the base data of the release of wantedDate ("latest" or YYYYMMDD).
+// An error matching ErrNoIssue is returned if there is no release on that date.
+func (c *Client) Issue(ctx context.Context, wantedDate string) (*Ausgabe, error) {
+	// Die Ausgabe selbst kann sich jederzeit ändern, alles weitere
+	// gehört zu ihrer Version
+	c.setCacheVersion(0)
+	zeitung := new(Ausgabe)
+	if err := c.getJSON(ctx, wantedDate, zeitung); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, &noIssueError{err}
+		}
+		return nil, err
+	}
+	c.setCacheVersion(zeitung.Version)
+
+	if zeitung.Pages < 1 {
+		return nil, &noIssueError{fmt.Errorf("Ausgabe %s hat keine Seiten: %w", wantedDate, ErrNotFound)}
+	}
+	// An Tagen ohne Ausgabe liefert die API eventuell eine andere
+	if wantedDate != "latest" && wantedDate != strconv.Itoa(zeitung.Date) {
+		return nil, &noIssueError{fmt.Errorf("Keine Ausgabe am %s, nur am %d: %w", wantedDate, zeitung.Date, ErrNotFound)}
+	}
+	return zeitung, nil
+}
+
+// CreateAzanEpub - Downloads the release of wantedDate ("latest" or YYYYMMDD)
+// and writes it as an ePub to OutputDir.
+// It returns the name of the file written. The file is replaced atomically,
+// if ctx is cancelled or an error occurs, nothing is left behind.
+// If the release was already written in the same version (see StateFile),
+// it returns the name of that file and ErrUnchanged unless Force is set.
+// With Validate set, an ePub with problems is not written, see InvalidError.
+func (c *Client) CreateAzanEpub(ctx context.Context, wantedDate string) (filename string, err error) {
+
+	// Hole die Basisdatei der gewünschten Ausgabe
+	zeitung, err := c.Issue(ctx, wantedDate)
+	if err != nil {
+		return "", err
+	}
+
+	if !zeitung.Subscription && !zeitung.Bought {
+		return "", fmt.Errorf("Die %s wurde weder abonniert noch gekauft: %w", zeitung.Title, ErrNotSubscribed)
+	}
+
+	// Das Datum ist als String in der Ausgabe hinterlegt
+	strdate := strconv.Itoa(zeitung.Date)
+	date, _ := time.Parse("20060102", strdate)
+	c.shareDate(strdate)
+
+	// Erstelle eine Datei für das ePub
+	if filename, err = c.filename(zeitung, date); err != nil {
+		return "", err
+	}
+
+	// Wurde die Ausgabe in dieser Version schon geschrieben?
+	key := stateKey(c.Ausgabe, strdate)
+	previous, known := c.issueState(key)
+	if known && !c.Force && previous.upToDate(zeitung.Version, filename) {
+		return filename, fmt.Errorf("%s vom %s, Version %d: %w", c.Ausgabe, date.Format("2006-01-02"), zeitung.Version, ErrUnchanged)
+	}
+	// Die Prüfsummen der Artikel für die Statusdatei
+	pruefsummen := map[string]string{}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return "", err
+	}
+	// Das ePub wird unter einem temporären Namen im Zielverzeichnis
+	// geschrieben und erst vollständig umbenannt. Bei Fehlern und
+	// Abbruch über ctx bleibt weder eine halbe Datei noch Müll zurück.
+	epubFile, err := ioutil.TempFile(filepath.Dir(filename), ".azdl-*.epub.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := epubFile.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err == nil && c.Validate {
+			err = validate(epubFile.Name(), filename)
+		}
+		if err == nil {
+			err = os.Chmod(epubFile.Name(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(epubFile.Name(), filename)
+		}
+		if err == nil {
+			if known && previous.Version != zeitung.Version {
+				added, changed, removed := previous.changes(pruefsummen)
+				c.logf("%s: Version %d statt %d, %d Artikel neu, %d geändert, %d entfallen",
+					filename, zeitung.Version, previous.Version, added, changed, removed)
+			}
+			c.storeIssueState(key, issueState{
+				Version:  zeitung.Version,
+				Filename: filename,
+				Written:  time.Now().UTC(),
+				Articles: pruefsummen,
+			})
+		}
+		if err != nil {
+			os.Remove(epubFile.Name())
+			filename = ""
+		}
+	}()
+
+	// Unveränderte Artikel und Bilder aus dem vorigen ePub übernehmen.
+	// Es wird vor dem Umbenennen oben geschlossen.
+	var vorher *previousEpub
+	if !c.Force {
+		vorher = openPrevious(filename, c.Ausgabe, strdate)
+	}
+	defer vorher.Close()
+	// Die Quelldaten für den nächsten Neubau
+	manifest := epubManifest{
+		Paper:    c.Ausgabe,
+		Date:     strdate,
+		Version:  zeitung.Version,
+		Articles: map[string]storedArticle{},
+		Pictures: map[string]validators{},
+	}
+
+	azanEpub := zip.NewWriter(epubFile)
+
+	// Füge einige Standard Dateien zum ePub hinzu archive.
+	if err := zipString(azanEpub, "mimetype", "application/epub+zip"); err != nil {
+		return "", err
+	}
+	titelbild, err := c.loadIfModified(ctx, strdate+"/0/big", vorher.picture("OEBPS/images/title.jpg"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := titelbild.save(azanEpub, "OEBPS/images/title.jpg"); err != nil {
+		return "", err
+	}
+	if titelbild.validators.known() {
+		manifest.Pictures["OEBPS/images/title.jpg"] = titelbild.validators
+	}
+	for _, f := range []struct{ name, content string }{
+		{"OEBPS/title.xhtml", templates.TitlePage},
+		{"OEBPS/zva.epub.css", c.css()},
+		{"META-INF/container.xml", templates.ContainerXML},
+	} {
+		if err := zipString(azanEpub, f.name, f.content); err != nil {
+			return "", err
+		}
+	}
+	if err := writeTemplate(azanEpub, "OEBPS/impressum.xhtml", templates.Imprint, struct{ Text string }{c.impressum()}); err != nil {
+		return "", err
+	}
+	if err := writeTemplate(azanEpub, "OEBPS/index.xhtml", templates.Index, struct {
+		URL     string
+		Ausgabe *Ausgabe
+		Date    time.Time
+	}{
+		c.BaseURL,
+		zeitung,
+		date,
+	}); err != nil {
+		return "", err
+	}
+
+	// Array für die Seiten
+	seiten := make([]*Seite, zeitung.Pages)
+	// Alle Seiten parallel laden
+	if err := c.parallel(ctx, zeitung.Pages, func(ctx context.Context, i int) error {
+		dieseSeite := new(Seite)
+		if err := c.getJSON(ctx, strdate+"/"+strconv.Itoa(i), dieseSeite); err != nil {
+			return err
+		}
+		seiten[i] = dieseSeite
+		if c.Progress != nil {
+			c.Progress(i, zeitung.Pages)
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+
+	// Alle Artikel aller Seiten parallel laden. Die Artikel werden
+	// anschließend in der ursprünglichen Reihenfolge verarbeitet.
+	type artikelRef struct{ seite, element int }
+	var refs []artikelRef
+	geladen := make([][]*Article, zeitung.Pages)
+	for i, dieseSeite := range seiten {
+		geladen[i] = make([]*Article, len(dieseSeite.Elements))
+		if c.skipPage(dieseSeite) {
+			continue
+		}
+		for idx, element := range dieseSeite.Elements {
+			// Wir laden nur Titel, Keine Werbung, keine Bilder
+			if element.Type == "article" {
+				refs = append(refs, artikelRef{i, idx})
+			}
+		}
+	}
+	// Die API nennt keine Änderung am Text eines Artikels. Jeder Artikel
+	// wird daher angefragt, aus dem vorigen ePub aber nur übernommen,
+	// wenn der Server ihn als unverändert meldet.
+	quellen := make([]storedArticle, len(refs))
+	artikelUebernommen := make([]bool, len(refs))
+	if err := c.parallel(ctx, len(refs), func(ctx context.Context, n int) error {
+		ref := refs[n]
+		dieseSeite := seiten[ref.seite]
+		element := &dieseSeite.Elements[ref.element]
+		artikel := new(Article)
+		source, reused, unchanged, err := c.getArticle(ctx, element.ID, strdate+"/"+strconv.Itoa(ref.seite)+"/"+element.ID,
+			vorher.article(articleKey(ref.seite, element.ID)), artikel)
+		if err != nil {
+			return err
+		}
+		if reused {
+			artikel.relocate(zeitung, dieseSeite)
+		}
+		quellen[n] = source
+		artikelUebernommen[n] = unchanged
+		geladen[ref.seite][ref.element] = artikel
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	for n, ref := range refs {
+		if quellen[n].Validators.known() {
+			manifest.Articles[articleKey(ref.seite, seiten[ref.seite].Elements[ref.element].ID)] = quellen[n]
+		}
+	}
+
+	// map für die Artikel
+	alleArtikel := map[string]*Article{}
+	alleBilder := map[string]*Picture{}
+	vorlagen := map[*Article]*template.Template{}
+	// Die Bilder, die noch geladen werden müssen
+	type bildAuftrag struct {
+		artikel *Article
+		idx     int
+		url     string
+		bild    *download
+	}
+	var bilder []*bildAuftrag
+	var duplicateCount int
+	// Durch alle Seiten iterieren
+	for i, dieseSeite := range seiten {
+
+		// relative URL der Seite
+		seitenURL := strdate + "/" + strconv.Itoa(i)
+
+		// Anhand der Verlinkung wird ermittelt,
+		// Welcher Artikel auf derSeite der
+		// erste sein soll
+		ersterArtikel := -1
+
+		// Für die Ermittlung der Reihenfolge müssen wir
+		// von der Artikel-ID auf ihren Index
+		id2idx := make(map[string]int)
+		// und vom Index auf die Artikel-ID des Folgeartikels
+		// schließen können
+		idx2next := make([]string, len(dieseSeite.Elements))
+
+		// iteriere durch die Seitenelemente
+		for idx, artikel := range geladen[i] {
+			// Alles ausser article wird ignoriert.
+			if artikel == nil {
+				continue
+			}
+
+			if original, duplicate := alleArtikel[artikel.ID]; duplicate {
+				// Doppelter Artikel
+				// Derselbe Artikel kann öfter als zweimal vorkommen,
+				// Dateiname und id zählen daher mit
+				duplicateCount++
+				artikel.XMLID = "duplicate_" + strconv.Itoa(duplicateCount)
+				artikel.Filename = artikel.XMLID + ".xhtml"
+				artikel.Underline = `<a href="article_` + artikel.ID + `.xhtml">Seite ` + strconv.Itoa(original.Paper.Page.Number) + `</a>`
+				artikel.AltTitle = original.AltTitle
+				// Der Titel wird wie beim Original nur von Entities befreit
+				artikel.Title = html.UnescapeString(artikel.Title)
+				alleArtikel[artikel.XMLID] = artikel
+				id2idx[artikel.XMLID] = idx
+				idx2next[idx] = artikel.Next.ID
+				// Nur ein Vorgänger auf dieser Seite verweist auf das Duplikat
+				if prev, ok := id2idx[artikel.Prev.ID]; ok {
+					idx2next[prev] = artikel.XMLID
+				}
+				dieseSeite.Elements[idx].Article = artikel
+				vorlagen[artikel] = templates.DupArticle
+			} else {
+				artikel.Filename = "article_" + artikel.ID + ".xhtml"
+				artikel.XMLID = "article_" + artikel.ID
+
+				// Verknüpfungen
+				alleArtikel[artikel.ID] = artikel
+				id2idx[artikel.ID] = idx
+				idx2next[idx] = artikel.Next.ID
+
+				// Alternativtitel erstellen aus
+				// dem Inhalt des Artikels
+				pruefsummen[artikel.ID] = artikel.checksum()
+				altTitle := c.cheapExerpt(artikel)
+				c.clean(artikel)
+				artikel.AltTitle = altTitle
+				dieseSeite.Elements[idx].Article = artikel
+				dieseSeite.Elements[idx].Pictures = artikel.Pictures
+
+				// Bilder vormerken
+				for idx, picture := range artikel.Pictures {
+					bild := "images/" + picture.ID + ".jpg"
+					if _, ok := alleBilder[bild]; !ok {
+						alleBilder[bild] = &artikel.Pictures[idx]
+						bilder = append(bilder, &bildAuftrag{
+							artikel: artikel,
+							idx:     idx,
+							url:     seitenURL + "/" + picture.ID + "/jpg",
+						})
+					}
+				}
+				vorlagen[artikel] = templates.Article
+			}
+
+			// Prüfe, ob es sich um den ersten Artikel handelt
+			if ersterArtikel < 0 && (artikel.Prev.ID == "" || artikel.Prev.Paper.Page.Index < artikel.Paper.Page.Index) {
+				ersterArtikel = idx
+			}
+		}
+		// Reihenfolge der Artikel auf der Seite ermitteln
+		dieseSeite.Sequence = make([]Element, 0, len(id2idx))
+		eingereiht := make([]bool, len(dieseSeite.Elements))
+		// Verweist die Kette auf einen Artikel der Seite zurück (ein
+		// Duplikat verweist auf sich selbst), endet sie mit der Seite
+		for art := ersterArtikel; art >= 0 && !eingereiht[art]; {
+			dieseSeite.Sequence = append(dieseSeite.Sequence, dieseSeite.Elements[art])
+			eingereiht[art] = true
+			nextID := idx2next[art]
+			if nextID == "" {
+				break
+			}
+			var ok bool
+			if art, ok = id2idx[nextID]; !ok {
+				break
+			}
+		}
+		// Von anderen Ausgaben übernommene Artikel verweisen eventuell auf
+		// deren Lokalteil. Was die Kette nicht erreicht, kommt ans Ende.
+		for idx, element := range dieseSeite.Elements {
+			if element.Article != nil && !eingereiht[idx] {
+				dieseSeite.Sequence = append(dieseSeite.Sequence, element)
+			}
+		}
+	}
+
+	// Bilder parallel holen
+	bilderUebernommen := make([]bool, len(bilder))
+	if err := c.parallel(ctx, len(bilder), func(ctx context.Context, n int) error {
+		var err error
+		auftrag := bilder[n]
+		id := auftrag.artikel.Pictures[auftrag.idx].ID
+		bildVorher := vorher.picture("OEBPS/images/" + id + ".jpg")
+		auftrag.bild, err = c.loadPicture(ctx, id, auftrag.url, bildVorher)
+		bilderUebernommen[n] = bildVorher != nil && auftrag.bild == bildVorher
+		return err
+	}); err != nil {
+		return "", err
+	}
+	if vorher != nil {
+		c.logf("%d von %d Artikeln und %d von %d Bildern aus dem vorigen ePub übernommen",
+			count(artikelUebernommen), len(refs), count(bilderUebernommen), len(bilder))
+	}
+
+	// Bilder, Artikel und Seiten in der ursprünglichen Reihenfolge schreiben
+	for i, dieseSeite := range seiten {
+		for _, artikel := range geladen[i] {
+			if artikel == nil {
+				continue
+			}
+			for len(bilder) > 0 && bilder[0].artikel == artikel {
+				picture := &artikel.Pictures[bilder[0].idx]
+				filename := "images/" + picture.ID + ".jpg"
+				size, err := bilder[0].bild.save(azanEpub, "OEBPS/"+filename)
+				if err != nil {
+					return "", err
+				}
+				picture.Size = size
+				picture.Filename = filename
+				if size > 0 && bilder[0].bild.validators.known() {
+					manifest.Pictures["OEBPS/"+filename] = bilder[0].bild.validators
+				}
+				if size < 1 {
+					c.logf("Fehlendes Bild Seite %d %s", dieseSeite.Number, artikel.AltTitle)
+				}
+				bilder = bilder[1:]
+			}
+
+			// xhtml Datei für den Artikel erstellen
+			date, _ := time.Parse("20060102", artikel.Paper.Date)
+			if err := writeTemplate(azanEpub, "OEBPS/"+artikel.Filename, vorlagen[artikel], struct {
+				URL  string
+				A    *Article
+				Date time.Time
+			}{
+				c.BaseURL,
+				artikel,
+				date,
+			}); err != nil {
+				return "", err
+			}
+		}
+
+		// Vorgänger und Nachfolger für
+		// die Inhaltsangaben der Seiten
+		var nextPage pgInfo
+		if i+1 < zeitung.Pages {
+			nextPage.Index = i + 1
+			nextPage.Title = pageTitle(zeitung, seiten, i+1)
+		}
+		var prevPage pgInfo
+		if i > 0 {
+			prevPage.Index = i - 1
+			prevPage.Title = pageTitle(zeitung, seiten, i-1)
+		}
+
+		// Inhaltsangabe der Seite erstellen
+		if err := writeTemplate(azanEpub, "OEBPS/seite_"+strconv.Itoa(dieseSeite.Index)+".xhtml", templates.Seite, struct {
+			URL     string
+			Ausgabe *Ausgabe
+			Seite   *Seite
+			Date    time.Time
+			Prev    pgInfo
+			Next    pgInfo
+		}{
+			c.BaseURL,
+			zeitung,
+			dieseSeite,
+			date,
+			prevPage,
+			nextPage,
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	// Daten für Table Of Content etc.
+	data := struct {
+		URL         string
+		Ausgabe     *Ausgabe
+		Seiten      []*Seite
+		Date        time.Time
+		AlleArtikel map[string]*Article
+		AlleBilder  map[string]*Picture
+	}{
+		c.BaseURL,
+		zeitung,
+		seiten,
+		date,
+		alleArtikel,
+		alleBilder,
+	}
+
+	// ePub Steuerdateien erstellen
+	if err := writeTemplate(azanEpub, "OEBPS/toc.ncx", templates.ToC, data); err != nil {
+		return "", err
+	}
+	if err := writeTemplate(azanEpub, "OEBPS/content.opf", templates.ContentOPF, data); err != nil {
+		return "", err
+	}
+	if err := writeTemplate(azanEpub, "OEBPS/navigation.xhtml", templates.NAV, data); err != nil {
+		return "", err
+	}
+
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	if err := zipString(azanEpub, azdlManifest, string(manifestData)); err != nil {
+		return "", err
+	}
+
+	// Make sure to check the error on Close.
+	if err := azanEpub.Close(); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// validate - Prüft die temporäre Datei tmp, die zu filename wird
+func validate(tmp, filename string) error {
+	problems, err := epubcheck.Check(tmp)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return &InvalidError{Filename: filename, Problems: problems}
+	}
+	return nil
+}
+
+// pageTitle - Der Titel der Seite i. Fehlt er in der Ausgabe, gilt
+// der Titel der Seite selbst.
+func pageTitle(zeitung *Ausgabe, seiten []*Seite, i int) string {
+	if i < len(zeitung.Titles) {
+		return zeitung.Titles[i]
+	}
+	return seiten[i].Title
+}
+
+// css - Das Stylesheet des ePubs
+func (c *Client) css() string {
+	if c.CSS != "" {
+		return c.CSS
+	}
+	return templates.ZvaCSS
+}
+
+// impressum - Das Impressum aus der App als XHTML
+func (c *Client) impressum() string {
+	return xhtml(c.Impressum, func(construct string) {
+		c.unknownHTML("Impressum", construct)
+	})
+}
+
+// skipPage - Sollen die Artikel der Seite ausgelassen werden?
+func (c *Client) skipPage(seite *Seite) bool {
+	for _, title := range c.SkipPages {
+		if strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(seite.Title)) {
+			return true
+		}
+	}
+	return false
+}
+
+// count - Die Anzahl der gesetzten Werte
+func count(flags []bool) int {
+	n := 0
+	for _, flag := range flags {
+		if flag {
+			n++
+		}
+	}
+	return n
+}
+
+func writeTemplate(zipWriter *zip.Writer, filename string, tpl *template.Template, data interface{}) error {
+	f, err := zipWriter.Create(filename)
+	if err != nil {
+		return err
+	}
+	return tpl.Execute(f, data)
+}
+
+func zipString(zipWriter *zip.Writer, filename string, content string) error {
+
+	var f io.Writer
+	var err error
+	if filename == "mimetype" {
+		f, err = zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   filename,
+			Method: zip.Store,
+		})
+	} else {
+		f, err = zipWriter.Create(filename)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte(content))
+	return err
+}
@@ -0,0 +1,548 @@
+package epaper_test
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"hradek.net/azdl/epaper"
+	"hradek.net/azdl/epaper/epapertest"
+	"hradek.net/azdl/epubcheck"
+)
+
+func TestMain(m *testing.M) {
+	// Die Tests dürfen den Cache des Benutzers nicht anfassen
+	dir, err := ioutil.TempDir("", "azdl-test-")
+	if err != nil {
+		panic(err)
+	}
+	for _, env := range []string{"HOME", "XDG_CACHE_HOME", "XDG_CONFIG_HOME", "LocalAppData", "AppData"} {
+		os.Setenv(env, dir)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newClient - Ein am Fake Server angemeldeter Client für az-d
+func newClient(t *testing.T, s *epapertest.Server) *epaper.Client {
+	t.Helper()
+	ctx := context.Background()
+	c, err := epaper.NewClientWithTransport(ctx, s.Transport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Retry.MinBackoff = time.Millisecond
+	c.Retry.MaxBackoff = 10 * time.Millisecond
+	c.OutputDir = t.TempDir()
+	c.TokenCache = ""
+	c.StateFile = filepath.Join(c.OutputDir, "state.json")
+	if err := c.Login(ctx, "az-d", s.User, s.Password); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// zipNames - Die Dateien im ePub in ihrer Reihenfolge
+func zipNames(t *testing.T, filename string) []string {
+	t.Helper()
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func zipFile(t *testing.T, filename, name string) string {
+	t.Helper()
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == name {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+	t.Fatalf("%s fehlt in %s", name, filename)
+	return ""
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEditionsFromBundle(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	if got := c.Ed2Name["an-a1"]; got != "Aachener Nachrichten Stadt" {
+		t.Errorf("Ed2Name[an-a1] = %q", got)
+	}
+	if got := c.Editions["az-d"].Brand; got != "az" {
+		t.Errorf("Brand von az-d = %q", got)
+	}
+	if !strings.Contains(c.Impressum, "Dresdener Straße 3") || !strings.Contains(c.Impressum, "<br />") {
+		t.Errorf("Impressum = %q", c.Impressum)
+	}
+}
+
+func TestCreateAzanEpub(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+
+	filename, err := c.CreateAzanEpub(context.Background(), "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(c.OutputDir, "az-d-2020-10-02.epub"); filename != want {
+		t.Errorf("filename = %s, erwartet %s", filename, want)
+	}
+	problems, err := epubcheck.Check(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+
+	names := zipNames(t, filename)
+	if names[0] != "mimetype" {
+		t.Errorf("erste Datei %s statt mimetype", names[0])
+	}
+	for _, name := range []string{
+		"OEBPS/article_1001.xhtml",
+		"OEBPS/article_1002-az-d.xhtml",
+		"OEBPS/article_1003.xhtml",
+		"OEBPS/duplicate_1.xhtml",
+		"OEBPS/article_1004.xhtml",
+		"OEBPS/images/2094290259_e7c39b54a0.irprodgera_i14u8q.jpg",
+		"OEBPS/images/title.jpg",
+		"OEBPS/content.opf",
+		"OEBPS/toc.ncx",
+		"OEBPS/navigation.xhtml",
+	} {
+		if !contains(names, name) {
+			t.Errorf("%s fehlt", name)
+		}
+	}
+	if opf := zipFile(t, filename, "OEBPS/content.opf"); !strings.Contains(opf, `<meta property="azdl:version">1</meta>`) {
+		t.Error("Version fehlt in content.opf")
+	}
+	// Die Werbung ist kein Artikel
+	if n := s.Requests(`/ad-`); n != 0 {
+		t.Errorf("%d Requests für Werbung", n)
+	}
+}
+
+// modified - Der Zeitstempel in content.opf
+var modified = regexp.MustCompile(`<meta property="dcterms:modified">[^<]*</meta>`)
+
+func TestConcurrencySameEpub(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	// Was zuerst angefragt wird, kommt parallel zuletzt an
+	for _, pattern := range []string{
+		`^/api/az-d/20201002/0$`,
+		`^/api/az-d/20201002/0/1001$`,
+		`^/api/az-d/20201002/0/2094290259_e7c39b54a0.irprodgera_i14u8q/jpg$`,
+	} {
+		s.AddFault(epapertest.Fault{Pattern: pattern, Delay: 50 * time.Millisecond})
+	}
+	var epubs []string
+	for _, concurrency := range []int{1, 8} {
+		c := newClient(t, s)
+		c.Concurrency = concurrency
+		filename, err := c.CreateAzanEpub(context.Background(), "20201002")
+		if err != nil {
+			t.Fatal(err)
+		}
+		epubs = append(epubs, filename)
+	}
+
+	names := zipNames(t, epubs[0])
+	if parallel := zipNames(t, epubs[1]); !reflect.DeepEqual(names, parallel) {
+		t.Fatalf("Reihenfolge parallel\n%v\nstatt\n%v", parallel, names)
+	}
+	for _, name := range names {
+		want, got := zipFile(t, epubs[0], name), zipFile(t, epubs[1], name)
+		if name == "OEBPS/content.opf" {
+			want = modified.ReplaceAllString(want, "")
+			got = modified.ReplaceAllString(got, "")
+		}
+		if got != want {
+			t.Errorf("%s unterscheidet sich", name)
+		}
+	}
+}
+
+func TestTriplicate(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	// Der doppelte Artikel steht zusätzlich auf der Titelseite
+	issue := s.Issues["az-d/20201002"]
+	issue.Pages[0].Articles = append(issue.Pages[0].Articles, issue.Pages[1].Articles[0])
+	c := newClient(t, s)
+	c.Validate = true
+	filename, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := zipNames(t, filename)
+	for _, name := range []string{
+		"OEBPS/article_1003.xhtml",
+		"OEBPS/duplicate_1.xhtml",
+		"OEBPS/duplicate_2.xhtml",
+	} {
+		if !contains(names, name) {
+			t.Errorf("%s fehlt", name)
+		}
+	}
+	// Alle Artikel stehen in der Reihenfolge
+	opf := zipFile(t, filename, "OEBPS/content.opf")
+	last := -1
+	for _, id := range []string{"article_1001", "article_1002-az-d", "article_1003", "duplicate_1", "duplicate_2", "article_1004"} {
+		i := strings.Index(opf, `<itemref idref="`+id+`"`)
+		if i < last {
+			t.Errorf("%s fehlt in der spine oder steht an falscher Stelle", id)
+		}
+		last = i
+	}
+}
+
+func TestDuplicateTitleEntity(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.Issues["az-d/20201002"].Pages[1].Articles[0].Title = "Rat &amp; Verwaltung"
+	c := newClient(t, s)
+	filename, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Original und Duplikat maskieren das & genau einmal
+	for _, name := range []string{"OEBPS/article_1003.xhtml", "OEBPS/duplicate_1.xhtml"} {
+		article := zipFile(t, filename, name)
+		if !strings.Contains(article, "Rat &amp; Verwaltung") || strings.Contains(article, "&amp;amp;") {
+			t.Errorf("%s: Titel falsch maskiert", name)
+		}
+	}
+}
+
+func TestMissingPageTitles(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.Issues["az-d/20201002"].PageTitles = []string{"TITELSEITE"}
+	c := newClient(t, s)
+	filename, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Der Titel kommt dann von der Seite selbst
+	if seite := zipFile(t, filename, "OEBPS/seite_0.xhtml"); !strings.Contains(seite, "POLITIK") {
+		t.Error("Titel der nächsten Seite fehlt")
+	}
+}
+
+func TestIssueNotFound(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	_, err := c.Issue(context.Background(), "20201003")
+	if !errors.Is(err, epaper.ErrNoIssue) || !errors.Is(err, epaper.ErrNotFound) {
+		t.Errorf("err = %v, erwartet ErrNoIssue", err)
+	}
+}
+
+func TestPageNotFound(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.AddFault(epapertest.Fault{Pattern: `^/api/az-d/20201002/2$`, Status: 404})
+	c := newClient(t, s)
+	_, err := c.CreateAzanEpub(context.Background(), "20201002")
+	// Eine fehlende Seite ist ein Fehler, kein Tag ohne Ausgabe
+	if !errors.Is(err, epaper.ErrNotFound) || errors.Is(err, epaper.ErrNoIssue) {
+		t.Errorf("err = %v, erwartet ErrNotFound ohne ErrNoIssue", err)
+	}
+}
+
+func TestNotSubscribed(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.Issues["az-d/20201002"].Subscription = false
+	c := newClient(t, s)
+	_, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if !errors.Is(err, epaper.ErrNotSubscribed) {
+		t.Errorf("err = %v, erwartet ErrNotSubscribed", err)
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c, err := epaper.NewClientWithTransport(context.Background(), s.Transport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.TokenCache = ""
+	err = c.Login(context.Background(), "az-d", s.User, "falsch")
+	if !errors.Is(err, epaper.ErrUnauthorized) || !strings.Contains(err.Error(), "Passwort falsch") {
+		t.Errorf("err = %v, erwartet ErrUnauthorized mit der Meldung der API", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.AddFault(epapertest.Fault{Pattern: `^/api/az-d/20201002/1$`, Status: 503, RetryAfter: "0", Times: 2})
+	c := newClient(t, s)
+	if _, err := c.CreateAzanEpub(context.Background(), "20201002"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests(`^/api/az-d/20201002/1$`); n != 3 {
+		t.Errorf("%d Requests für Seite 1, erwartet 3", n)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.AddFault(epapertest.Fault{Pattern: `^/api/az-d/20201002/2$`, Status: 500, Body: "kaputt"})
+	c := newClient(t, s)
+	_, err := c.CreateAzanEpub(context.Background(), "20201002")
+	var apiErr *epaper.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, epaper.ErrServer) || apiErr.StatusCode != 500 {
+		t.Fatalf("err = %v, erwartet ErrServer", err)
+	}
+	if apiErr.Snippet != "kaputt" {
+		t.Errorf("Snippet = %q", apiErr.Snippet)
+	}
+	if n := s.Requests(`^/api/az-d/20201002/2$`); n != c.Retry.Attempts {
+		t.Errorf("%d Versuche, erwartet %d", n, c.Retry.Attempts)
+	}
+	// Es bleibt keine halbe Datei zurück
+	if files, _ := filepath.Glob(filepath.Join(c.OutputDir, "*.epub*")); len(files) > 0 {
+		t.Errorf("übrig geblieben: %v", files)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.AddFault(epapertest.Fault{Pattern: `^/api/az-d/20201002/0/1001$`, Body: `{"id": kaputt`})
+	c := newClient(t, s)
+	_, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if !errors.Is(err, epaper.ErrMalformed) {
+		t.Errorf("err = %v, erwartet ErrMalformed", err)
+	}
+}
+
+func TestRelogin(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	s.ExpireSessions()
+	if _, err := c.CreateAzanEpub(context.Background(), "20201002"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests(`^/api/user/login$`); n != 2 {
+		t.Errorf("%d Anmeldungen, erwartet 2", n)
+	}
+}
+
+func TestMissingPicture(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.Issues["az-d/20201002"].Pages[0].Articles[0].Pictures[0].Data = nil
+	c := newClient(t, s)
+	filename, err := c.CreateAzanEpub(context.Background(), "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contains(zipNames(t, filename), "OEBPS/images/2094290259_e7c39b54a0.irprodgera_i14u8q.jpg") {
+		t.Error("fehlendes Bild im ePub")
+	}
+}
+
+func TestSharedDownloads(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	ctx := context.Background()
+	for _, edition := range []string{"az-d", "an-a1"} {
+		if err := c.SelectEdition(edition); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.CreateAzanEpub(ctx, "20201002"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Der Mantel wird nur für die erste Ausgabe geladen
+	if n := s.Requests(`^/api/an-a1/20201002/0/1001$`); n != 0 {
+		t.Errorf("Artikel 1001 %d mal für an-a1 geladen", n)
+	}
+	if n := s.Requests(`/jpg$`); n != 2 {
+		t.Errorf("%d Bilder geladen, erwartet 2", n)
+	}
+	// Der lokale Artikel aber schon
+	if n := s.Requests(`^/api/an-a1/20201002/0/1002-an-a1$`); n != 1 {
+		t.Errorf("Artikel 1002-an-a1 %d mal geladen", n)
+	}
+}
+
+func TestUnchangedAndRebuild(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	ctx := context.Background()
+	first, err := c.CreateAzanEpub(ctx, "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename, err := c.CreateAzanEpub(ctx, "20201002")
+	if !errors.Is(err, epaper.ErrUnchanged) || filename != first {
+		t.Fatalf("err = %v, erwartet ErrUnchanged für %s", err, first)
+	}
+
+	// Eine neue Version, in der sich nur der Text eines Artikels ändert
+	issue := s.Issues["az-d/20201002"]
+	issue.Version = 2
+	issue.Pages[0].Articles[0].Text = "<p>Geänderter Text</p>"
+	s.ResetRequests()
+	// Ein neuer Client, damit nichts aus dem Speicher kommt
+	c2 := newClient(t, s)
+	c2.OutputDir, c2.StateFile = c.OutputDir, c.StateFile
+	if _, err := c2.CreateAzanEpub(ctx, "20201002"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Requests(`^/api/az-d/20201002/0/1001$`) - s.NotModified(`^/api/az-d/20201002/0/1001$`); n != 1 {
+		t.Errorf("geänderter Artikel %d mal geladen", n)
+	}
+	if article := zipFile(t, first, "OEBPS/article_1001.xhtml"); !strings.Contains(article, "Geänderter Text") {
+		t.Error("geänderter Text fehlt im Artikel")
+	}
+	// Alles andere meldet der Server als unverändert
+	if n := s.NotModified(`^/api/az-d/20201002/0/1002-az-d$`); n != 1 {
+		t.Errorf("unveränderter Artikel %d mal bedingt angefragt", n)
+	}
+	if n, m := s.Requests(`/(jpg|big)$`), s.NotModified(`/(jpg|big)$`); n != m || n == 0 {
+		t.Errorf("%d von %d Bildern erneut geladen", n-m, n)
+	}
+	if opf := zipFile(t, first, "OEBPS/content.opf"); !strings.Contains(opf, `<meta property="azdl:version">2</meta>`) {
+		t.Error("neue Version fehlt in content.opf")
+	}
+}
+
+func TestRebuildChangedPicture(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	ctx := context.Background()
+	first, err := c.CreateAzanEpub(ctx, "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Eine neue Version mit einem anderen Bild unter derselben ID
+	const bild = "OEBPS/images/2094290259_e7c39b54a0.irprodgera_i14u8q.jpg"
+	issue := s.Issues["az-d/20201002"]
+	issue.Version = 2
+	neu := append(append([]byte{}, epapertest.JPEG...), "neu"...)
+	issue.Pages[0].Articles[0].Pictures[0].Data = neu
+	c2 := newClient(t, s)
+	c2.OutputDir, c2.StateFile = c.OutputDir, c.StateFile
+	if _, err := c2.CreateAzanEpub(ctx, "20201002"); err != nil {
+		t.Fatal(err)
+	}
+	if got := zipFile(t, first, bild); got != string(neu) {
+		t.Errorf("%s ist nicht das neue Bild", bild)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	c := newClient(t, s)
+	c.Validate = true
+	ctx := context.Background()
+	first, err := c.CreateAzanEpub(ctx, "20201002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Eine neue Version ohne Titelbild, das im Manifest aber steht
+	issue := s.Issues["az-d/20201002"]
+	issue.Version = 2
+	s.TitleImage = nil
+	// Ein neuer Client, damit nichts aus dem Speicher kommt
+	c2 := newClient(t, s)
+	c2.OutputDir, c2.StateFile, c2.Validate = c.OutputDir, c.StateFile, true
+	filename, err := c2.CreateAzanEpub(ctx, "20201002")
+	var invalid *epaper.InvalidError
+	if !errors.As(err, &invalid) || !errors.Is(err, epaper.ErrInvalid) {
+		t.Fatalf("err = %v, erwartet InvalidError", err)
+	}
+	if filename != "" || invalid.Filename != first || len(invalid.Problems) == 0 {
+		t.Errorf("filename = %q, InvalidError = %+v", filename, invalid)
+	}
+	if opf := zipFile(t, first, "OEBPS/content.opf"); !strings.Contains(opf, `<meta property="azdl:version">1</meta>`) {
+		t.Error("das vorige ePub wurde ersetzt")
+	}
+	if names, _ := filepath.Glob(filepath.Join(filepath.Dir(first), ".azdl-*")); len(names) > 0 {
+		t.Errorf("temporäre Dateien übrig: %v", names)
+	}
+
+	// Die Statusdatei kennt weiter Version 1
+	issue.Version = 1
+	if _, err := c.CreateAzanEpub(ctx, "20201002"); !errors.Is(err, epaper.ErrUnchanged) {
+		t.Errorf("err = %v, erwartet ErrUnchanged", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s := epapertest.NewServer()
+	defer s.Close()
+	s.AddFault(epapertest.Fault{Pattern: `^/api/az-d/20201002/2/`, Delay: time.Minute})
+	c := newClient(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.CreateAzanEpub(ctx, "20201002"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, erwartet DeadlineExceeded", err)
+	}
+	files, err := ioutil.ReadDir(c.OutputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("übrig geblieben: %s", f.Name())
+	}
+}
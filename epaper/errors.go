@@ -0,0 +1,145 @@
+package epaper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"hradek.net/azdl/epubcheck"
+)
+
+// The kinds of errors reported by the ePaper API.
+// Check for them with errors.Is.
+var (
+	ErrUnauthorized = errors.New("nicht angemeldet")
+	ErrNotFound     = errors.New("nicht gefunden")
+	ErrServer       = errors.New("Serverfehler")
+	ErrStatus       = errors.New("unerwarteter HTTP Status")
+	ErrMalformed    = errors.New("ungültige Antwort")
+)
+
+// ErrNotSubscribed - The release was neither subscribed nor bought
+var ErrNotSubscribed = errors.New("kein Zugriff auf die Ausgabe")
+
+// ErrNotCached - An offline client found no answer in the cache
+var ErrNotCached = errors.New("nicht im Cache")
+
+// ErrNoIssue - There is no release on the date asked for, e.g. on a
+// Sunday. The error also matches ErrNotFound. A 404 for a page, article
+// or picture of an existing release does not match ErrNoIssue.
+var ErrNoIssue = errors.New("keine Ausgabe")
+
+// noIssueError - Die Ausgabe selbst fehlt, err ist der Grund
+type noIssueError struct {
+	err error
+}
+
+func (e *noIssueError) Error() string {
+	return e.err.Error()
+}
+
+func (e *noIssueError) Unwrap() error {
+	return e.err
+}
+
+// Is - Passt zu ErrNoIssue, über Unwrap auch zu ErrNotFound
+func (e *noIssueError) Is(target error) bool {
+	return target == ErrNoIssue
+}
+
+// ErrUnchanged - The release was already written in this version
+var ErrUnchanged = errors.New("Ausgabe unverändert")
+
+// ErrInvalid - The ePub failed the check requested with Client.Validate
+var ErrInvalid = errors.New("ungültiges ePub")
+
+// InvalidError - The problems found in an ePub by Client.Validate.
+// Nothing was written.
+type InvalidError struct {
+	Filename string
+	Problems []epubcheck.Problem
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("%s: %v, %d Fehler", e.Filename, ErrInvalid, len(e.Problems))
+}
+
+// Unwrap - Allows errors.Is(err, ErrInvalid)
+func (e *InvalidError) Unwrap() error {
+	return ErrInvalid
+}
+
+// snippetLength - So viele Bytes des Bodies landen in einem APIError
+const snippetLength = 200
+
+// APIError - A failed request to the ePaper API
+type APIError struct {
+	// Kind is one of ErrUnauthorized, ErrNotFound, ErrServer, ErrStatus or ErrMalformed
+	Kind       error
+	Method     string
+	URL        string
+	StatusCode int
+	// Snippet is the beginning of the response body
+	Snippet string
+	// Err is the underlying error, e.g. the JSON decoding error
+	Err error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %v (HTTP %d)", e.Method, e.URL, e.Kind, e.StatusCode)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Snippet != "" {
+		msg += ": " + e.Snippet
+	}
+	return msg
+}
+
+// Unwrap - Allows errors.Is(err, ErrNotFound) etc.
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// newAPIError - Erstellt einen APIError für die Antwort
+func newAPIError(kind error, response *http.Response, data []byte, err error) *APIError {
+	return &APIError{
+		Kind:       kind,
+		Method:     response.Request.Method,
+		URL:        response.Request.URL.String(),
+		StatusCode: response.StatusCode,
+		Snippet:    snippet(data),
+		Err:        err,
+	}
+}
+
+// checkStatus - Liefert einen APIError für alle Statuscodes ab 400
+func checkStatus(response *http.Response, data []byte) error {
+	switch status := response.StatusCode; {
+	case status < 400:
+		return nil
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return newAPIError(ErrUnauthorized, response, data, nil)
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return newAPIError(ErrNotFound, response, data, nil)
+	case status >= 500:
+		return newAPIError(ErrServer, response, data, nil)
+	default:
+		return newAPIError(ErrStatus, response, data, nil)
+	}
+}
+
+// snippet - Der Anfang des Bodies als einzeiliger Text
+func snippet(data []byte) string {
+	if len(data) > snippetLength {
+		data = data[:snippetLength]
+		// Keine halben UTF-8 Zeichen ausgeben
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+		return strings.Join(strings.Fields(string(data)), " ") + "…"
+	}
+	return strings.Join(strings.Fields(string(data)), " ")
+}
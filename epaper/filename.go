@@ -0,0 +1,95 @@
+package epaper
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultFilename - The default template for the names of the ePubs
+const DefaultFilename = "{{.Paper}}-{{.Date}}.epub"
+
+// FileInfo - The fields available in the Filename template,
+// e.g. "{{.Brand}}/{{.Year}}/{{.Paper}}-{{.Date}}.epub"
+type FileInfo struct {
+	Paper string // Kürzel der Ausgabe, z.B. az-d
+	Title string // Titel der Ausgabe
+	Brand string // Kürzel der Zeitung, z.B. az oder an
+	Date  string // YYYY-MM-DD
+	Year  string // YYYY
+	Month string // MM
+	Day   string // DD
+	// Version - Die Version der Ausgabe, die API zählt sie bei Korrekturen hoch
+	Version int
+}
+
+// nameReplacer - Schrägstriche in den Feldern würden neue Verzeichnisse ergeben
+var nameReplacer = strings.NewReplacer("/", "-", `\`, "-", ":", "-")
+
+// ParseFilename - Checks the template for the names of the ePubs
+func ParseFilename(pattern string) (*template.Template, error) {
+	tpl, err := template.New("filename").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("ungültiges Muster für den Dateinamen: %w", err)
+	}
+	// Unbekannte Felder fallen erst beim Ausführen auf
+	if err := tpl.Execute(ioutil.Discard, FileInfo{}); err != nil {
+		return nil, fmt.Errorf("ungültiges Muster für den Dateinamen: %w", err)
+	}
+	return tpl, nil
+}
+
+// filename - Der Pfad des ePubs für zeitung vom date in OutputDir
+func (c *Client) filename(zeitung *Ausgabe, date time.Time) (string, error) {
+	pattern := c.Filename
+	if pattern == "" {
+		pattern = DefaultFilename
+	}
+	tpl, err := ParseFilename(pattern)
+	if err != nil {
+		return "", err
+	}
+	info := FileInfo{
+		Paper:   nameReplacer.Replace(c.Ausgabe),
+		Title:   nameReplacer.Replace(zeitung.Title),
+		Brand:   nameReplacer.Replace(zeitung.Brand),
+		Date:    date.Format("2006-01-02"),
+		Year:    date.Format("2006"),
+		Month:   date.Format("01"),
+		Day:     date.Format("02"),
+		Version: zeitung.Version,
+	}
+	if info.Brand == "" {
+		info.Brand = nameReplacer.Replace(c.Editions[c.Ausgabe].Brand)
+	}
+	var name strings.Builder
+	if err := tpl.Execute(&name, info); err != nil {
+		return "", fmt.Errorf("Dateiname aus %q: %w", pattern, err)
+	}
+	if err := checkRelative(name.String()); err != nil {
+		return "", fmt.Errorf("Dateiname %q aus %q %w", name.String(), pattern, err)
+	}
+	return filepath.Join(c.OutputDir, filepath.FromSlash(name.String())), nil
+}
+
+// checkRelative - Der Dateiname muss unterhalb von OutputDir bleiben.
+// Ein leeres Feld wie in "{{.Brand}}/{{.Year}}" ergäbe sonst einen
+// absoluten Pfad.
+func checkRelative(name string) error {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return errors.New("ist absolut")
+	}
+	for _, segment := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		switch strings.TrimSpace(segment) {
+		case "":
+			return errors.New("enthält einen leeren Namen")
+		case ".", "..":
+			return fmt.Errorf("enthält %s", segment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package epaper
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilename(t *testing.T) {
+	zeitung := &Ausgabe{Paper: "an-a1", Title: "Aachener Nachrichten Stadt", Brand: "an", Version: 2}
+	date := time.Date(2020, 9, 30, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pattern, want string
+		brand         string
+	}{
+		{"", "an-a1-2020-09-30.epub", "an"},
+		{"{{.Brand}}/{{.Year}}/{{.Paper}}-{{.Date}}.epub", "an/2020/an-a1-2020-09-30.epub", "an"},
+		{"{{.Title}}-v{{.Version}}.epub", "Aachener Nachrichten Stadt-v2.epub", "an"},
+		// Ohne Marke ergäbe sich /2020/…
+		{"{{.Brand}}/{{.Year}}/{{.Paper}}.epub", "", ""},
+		{"/tmp/{{.Paper}}.epub", "", "an"},
+		{"../{{.Paper}}.epub", "", "an"},
+		{"{{.Year}}//{{.Paper}}.epub", "", "an"},
+		{"{{.Year}}/./{{.Paper}}.epub", "", "an"},
+	}
+	for _, tt := range tests {
+		c := newClient()
+		c.Ausgabe = zeitung.Paper
+		c.Filename = tt.pattern
+		z := *zeitung
+		z.Brand = tt.brand
+		got, err := c.filename(&z, date)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%q ergibt %q statt eines Fehlers", tt.pattern, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+		} else if got != filepath.FromSlash(tt.want) {
+			t.Errorf("%q ergibt %q, erwartet %q", tt.pattern, got, tt.want)
+		}
+	}
+}
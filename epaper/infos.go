@@ -0,0 +1,194 @@
+package epaper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// appBundle - Das Script mit den Editionen und dem Impressum, z.B.
+// <script src="js/app-b4b5468874.js"></script>
+var appBundle = regexp.MustCompile(`<script\b[^>]*\bsrc=["']?([^"' >]*\bapp-[0-9a-zA-Z]+\.js)`)
+
+// infos - Der zuletzt erfolgreich gelesene Stand von Impressum und Editionen
+type infos struct {
+	Bundle    string             `json:"bundle"`
+	Fetched   time.Time          `json:"fetched"`
+	Impressum string             `json:"impressum"`
+	Editions  map[string]Edition `json:"editions"`
+}
+
+// DefaultInfoCache - The default location of the cached editions and imprint
+func DefaultInfoCache() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azdl", "infos.json"), nil
+}
+
+// loadInfos - Lädt Impressum und Editionen aus dem aktuellen App Bundle.
+// Schlägt das fehl, wird der zuletzt gespeicherte Stand verwendet.
+func (c *Client) loadInfos(ctx context.Context) error {
+	var bundle string
+	err := fmt.Errorf("offline: %w", ErrNotCached)
+	if !c.Offline {
+		bundle, err = c.discoverBundle(ctx)
+	}
+	if err == nil {
+		err = c.getInfos(ctx, bundle)
+	}
+	if err == nil {
+		c.storeInfos(bundle)
+		return nil
+	}
+
+	// Auf den gespeicherten Stand zurückgreifen
+	if ctx.Err() != nil || c.InfoCache == "" {
+		return err
+	}
+	cached, cerr := readInfos(c.InfoCache)
+	if cerr != nil {
+		c.logf("Gespeicherte Ausgaben %s nicht lesbar: %v", c.InfoCache, cerr)
+		return err
+	}
+	c.logf("%v; verwende Ausgaben aus %s vom %s", err, cached.Bundle, cached.Fetched.Local().Format("02.01.2006"))
+	c.Impressum = cached.Impressum
+	for _, edition := range cached.Editions {
+		c.addEdition(edition)
+	}
+	return nil
+}
+
+// discoverBundle - Sucht auf der Startseite die URL des App Bundles
+func (c *Client) discoverBundle(ctx context.Context) (string, error) {
+	start := c.BaseURL + "/"
+	request, err := http.NewRequestWithContext(ctx, "GET", start, nil)
+	if err != nil {
+		return "", err
+	}
+	_, data, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+	found := appBundle.FindSubmatch(data)
+	if found == nil {
+		return "", fmt.Errorf("kein App Bundle in %s gefunden", start)
+	}
+	base, err := url.Parse(start)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(string(found[1]))
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// readInfos - Liest den gespeicherten Stand
+func readInfos(filename string) (*infos, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cached := new(infos)
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil, err
+	}
+	if len(cached.Editions) == 0 {
+		return nil, errors.New("keine Ausgaben gespeichert")
+	}
+	return cached, nil
+}
+
+// storeInfos - Speichert Impressum und Editionen für den Notfall
+func (c *Client) storeInfos(bundle string) {
+	if c.InfoCache == "" {
+		return
+	}
+	data, err := json.MarshalIndent(&infos{
+		Bundle:    bundle,
+		Fetched:   time.Now().UTC(),
+		Impressum: c.Impressum,
+		Editions:  c.Editions,
+	}, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.InfoCache), 0700)
+	}
+	if err == nil {
+		err = WriteFileAtomic(c.InfoCache, 0600, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+	}
+	if err != nil {
+		c.logf("Ausgaben konnten nicht gespeichert werden: %v", err)
+	}
+}
+
+// getInfos - Liest Impressum und Editionen aus dem App Bundle
+func (c *Client) getInfos(ctx context.Context, bundleURL string) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", bundleURL, nil)
+	if err != nil {
+		return err
+	}
+	_, data, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	tokens, err := tokenizeJS(string(data))
+	if err != nil {
+		return fmt.Errorf("App Bundle %s nicht lesbar: %w", bundleURL, err)
+	}
+
+	// Impressum suchen. Es ist der Rest des Strings nach der Überschrift.
+	indicator := "<h1>Impressum</h1>"
+	impressum := false
+	for _, tok := range tokens {
+		if tok.kind != jsString {
+			continue
+		}
+		if pos := strings.Index(tok.value, indicator); pos >= 0 {
+			c.Impressum = strings.Replace(tok.value[pos+len(indicator):], "<br>", "<br />", -1)
+			impressum = true
+			break
+		}
+	}
+	if !impressum {
+		c.logf("Kein Impressum (String mit %s) in %s gefunden.", indicator, bundleURL)
+	}
+
+	// Editionen sind Objekte mit den Eigenschaften paper und title
+	for _, obj := range jsObjects(tokens) {
+		if obj["paper"] == "" || obj["title"] == "" {
+			continue
+		}
+		c.addEdition(Edition{
+			Paper:  obj["paper"],
+			Title:  obj["title"],
+			Brand:  obj["brand"],
+			Fields: obj,
+		})
+	}
+	if len(c.Editions) == 0 {
+		return fmt.Errorf("keine Ausgaben (Objekte mit paper und title) in %s gefunden", bundleURL)
+	}
+	return nil
+}
+
+func (c *Client) addEdition(edition Edition) {
+	c.Editions[edition.Paper] = edition
+	c.Ed2Name[edition.Paper] = edition.Title
+	c.Name2Ed[edition.Title] = edition.Paper
+}
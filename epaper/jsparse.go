@@ -0,0 +1,365 @@
+package epaper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Ein sehr einfacher Tokenizer für das JavaScript des App Bundles.
+// Er versteht gerade genug JavaScript, um Objektliterale mit
+// Strings als Werten und alle Stringliterale zu finden.
+
+type jsTokenKind int
+
+const (
+	jsPunct  jsTokenKind = iota // { } : , ( ) …
+	jsIdent                     // Namen und Schlüsselwörter
+	jsString                    // '…', "…" und `…`, bereits dekodiert
+	jsNumber                    // 42, 0x2a, 1e3
+	jsRegexp                    // /…/g
+)
+
+type jsToken struct {
+	kind  jsTokenKind
+	value string
+	pos   int
+}
+
+// jsSyntaxError - Eine Stelle, die der Tokenizer nicht verarbeiten kann
+type jsSyntaxError struct {
+	pos int
+	msg string
+}
+
+func (e *jsSyntaxError) Error() string {
+	return fmt.Sprintf("JavaScript Position %d: %s", e.pos, e.msg)
+}
+
+// tokenizeJS - Zerlegt src in Tokens. Kommentare und Leerraum entfallen,
+// direkt mit + verbundene Stringliterale werden zusammengefasst.
+func tokenizeJS(src string) ([]jsToken, error) {
+	var tokens []jsToken
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, &jsSyntaxError{i, "Kommentar nicht beendet"}
+			}
+			i += end + 4
+
+		case r == '"' || r == '\'':
+			value, end, err := scanJSString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = appendJSString(tokens, jsToken{jsString, value, i})
+			i = end
+
+		case r == '`':
+			value, end, err := scanJSTemplate(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = appendJSString(tokens, jsToken{jsString, value, i})
+			i = end
+
+		case r == '/' && regexpAllowed(tokens):
+			end, err := scanJSRegexp(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, jsToken{jsRegexp, src[i:end], i})
+			i = end
+
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			end := i + 1
+			for end < len(src) && (isJSIdentPart(rune(src[end])) || src[end] == '.' ||
+				(src[end] == '+' || src[end] == '-') && (src[end-1] == 'e' || src[end-1] == 'E')) {
+				end++
+			}
+			tokens = append(tokens, jsToken{jsNumber, src[i:end], i})
+			i = end
+
+		case isJSIdentStart(r):
+			end := i + size
+			for end < len(src) {
+				r, size := utf8.DecodeRuneInString(src[end:])
+				if !isJSIdentPart(r) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, jsToken{jsIdent, src[i:end], i})
+			i = end
+
+		default:
+			tokens = append(tokens, jsToken{jsPunct, string(r), i})
+			i += size
+		}
+	}
+	return tokens, nil
+}
+
+func isJSIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isJSIdentPart(r rune) bool {
+	return isJSIdentStart(r) || unicode.IsDigit(r)
+}
+
+// appendJSString - Hängt einen String an, "a" + "b" wird zu "ab"
+func appendJSString(tokens []jsToken, str jsToken) []jsToken {
+	n := len(tokens)
+	if n >= 2 && tokens[n-1].kind == jsPunct && tokens[n-1].value == "+" && tokens[n-2].kind == jsString {
+		tokens[n-2].value += str.value
+		return tokens[:n-1]
+	}
+	return append(tokens, str)
+}
+
+// regexpAllowed - Ein / beginnt einen regulären Ausdruck, wenn
+// davor kein Wert steht, der dividiert werden könnte
+func regexpAllowed(tokens []jsToken) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	switch last.kind {
+	case jsPunct:
+		return last.value != ")" && last.value != "]" && last.value != "}"
+	case jsIdent:
+		switch last.value {
+		case "return", "typeof", "case", "do", "else", "in", "instanceof", "new", "delete", "void", "throw":
+			return true
+		}
+	}
+	return false
+}
+
+// scanJSString - Liest das Stringliteral ab start und dekodiert es
+func scanJSString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); {
+		switch c := src[i]; c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, &jsSyntaxError{start, "String nicht beendet"}
+		case '\\':
+			n, err := decodeJSEscape(src, i, &b)
+			if err != nil {
+				return "", 0, err
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, &jsSyntaxError{start, "String nicht beendet"}
+}
+
+// scanJSTemplate - Liest ein Template Literal. Eingebettete Ausdrücke
+// ${…} werden übersprungen, ihr Text bleibt unverändert erhalten.
+func scanJSTemplate(src string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(src); {
+		switch c := src[i]; {
+		case c == '`':
+			return b.String(), i + 1, nil
+		case c == '\\':
+			n, err := decodeJSEscape(src, i, &b)
+			if err != nil {
+				return "", 0, err
+			}
+			i += n
+		case strings.HasPrefix(src[i:], "${"):
+			depth := 0
+			end := i + 1
+			for ; end < len(src); end++ {
+				if src[end] == '{' {
+					depth++
+				} else if src[end] == '}' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if end >= len(src) {
+				return "", 0, &jsSyntaxError{i, "Ausdruck im Template nicht beendet"}
+			}
+			b.WriteString(src[i : end+1])
+			i = end + 1
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, &jsSyntaxError{start, "Template nicht beendet"}
+}
+
+// scanJSRegexp - Überspringt einen regulären Ausdruck samt Flags
+func scanJSRegexp(src string, start int) (int, error) {
+	inClass := false
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			return 0, &jsSyntaxError{start, "Regulärer Ausdruck nicht beendet"}
+		case '/':
+			if !inClass {
+				i++
+				for i < len(src) && isJSIdentPart(rune(src[i])) {
+					i++
+				}
+				return i, nil
+			}
+		}
+	}
+	return 0, &jsSyntaxError{start, "Regulärer Ausdruck nicht beendet"}
+}
+
+// decodeJSEscape - Dekodiert die Escape Sequenz bei src[i] == '\\'
+// und liefert die Anzahl der gelesenen Bytes
+func decodeJSEscape(src string, i int, b *strings.Builder) (int, error) {
+	if i+1 >= len(src) {
+		return 0, &jsSyntaxError{i, "Escape Sequenz nicht beendet"}
+	}
+	switch c := src[i+1]; c {
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '0':
+		b.WriteByte(0)
+	case '\r':
+		// Zeilenfortsetzung
+		if i+2 < len(src) && src[i+2] == '\n' {
+			return 3, nil
+		}
+	case '\n':
+		// Zeilenfortsetzung
+	case 'x':
+		if i+4 > len(src) {
+			return 0, &jsSyntaxError{i, "ungültige \\x Sequenz"}
+		}
+		code, err := strconv.ParseUint(src[i+2:i+4], 16, 8)
+		if err != nil {
+			return 0, &jsSyntaxError{i, "ungültige \\x Sequenz"}
+		}
+		b.WriteRune(rune(code))
+		return 4, nil
+	case 'u':
+		r, n, err := decodeJSUnicode(src, i)
+		if err != nil {
+			return 0, err
+		}
+		// Surrogate Paare zusammensetzen
+		if utf16.IsSurrogate(r) && i+n+1 < len(src) && src[i+n] == '\\' && src[i+n+1] == 'u' {
+			if r2, n2, err := decodeJSUnicode(src, i+n); err == nil {
+				if combined := utf16.DecodeRune(r, r2); combined != unicode.ReplacementChar {
+					b.WriteRune(combined)
+					return n + n2, nil
+				}
+			}
+		}
+		b.WriteRune(r)
+		return n, nil
+	default:
+		// \' \" \\ und alle übrigen Zeichen stehen für sich selbst
+		r, size := utf8.DecodeRuneInString(src[i+1:])
+		b.WriteRune(r)
+		return 1 + size, nil
+	}
+	return 2, nil
+}
+
+// decodeJSUnicode - Dekodiert \uXXXX oder \u{X…} bei src[i]
+func decodeJSUnicode(src string, i int) (rune, int, error) {
+	hex, n := "", 0
+	if i+2 < len(src) && src[i+2] == '{' {
+		end := strings.IndexByte(src[i+3:], '}')
+		if end < 0 {
+			return 0, 0, &jsSyntaxError{i, "ungültige \\u Sequenz"}
+		}
+		hex, n = src[i+3:i+3+end], end+4
+	} else if i+6 <= len(src) {
+		hex, n = src[i+2:i+6], 6
+	}
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || code > unicode.MaxRune {
+		return 0, 0, &jsSyntaxError{i, "ungültige \\u Sequenz"}
+	}
+	return rune(code), n, nil
+}
+
+// jsObjects - Liefert für jedes Objektliteral die Eigenschaften,
+// deren Werte Strings oder Zahlen sind
+func jsObjects(tokens []jsToken) []map[string]string {
+	var (
+		objects []map[string]string
+		stack   []map[string]string
+	)
+	for i, tok := range tokens {
+		if tok.kind != jsPunct {
+			continue
+		}
+		switch tok.value {
+		case "{":
+			stack = append(stack, map[string]string{})
+		case "}":
+			if len(stack) == 0 {
+				continue
+			}
+			if obj := stack[len(stack)-1]; len(obj) > 0 {
+				objects = append(objects, obj)
+			}
+			stack = stack[:len(stack)-1]
+		case ":":
+			// { key: "wert", … } oder , key: "wert" }
+			if len(stack) == 0 || i < 2 || i+2 >= len(tokens) {
+				continue
+			}
+			key, before, value, after := tokens[i-1], tokens[i-2], tokens[i+1], tokens[i+2]
+			if (key.kind == jsIdent || key.kind == jsString) &&
+				before.kind == jsPunct && (before.value == "{" || before.value == ",") &&
+				(value.kind == jsString || value.kind == jsNumber) &&
+				after.kind == jsPunct && (after.value == "," || after.value == "}") {
+				stack[len(stack)-1][key.value] = value.value
+			}
+		}
+	}
+	return objects
+}
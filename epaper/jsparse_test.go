@@ -0,0 +1,158 @@
+package epaper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tokenStrings - Die Tokens ohne Position, z.B. "ident a" oder "string x"
+func tokenStrings(tokens []jsToken) []string {
+	kinds := map[jsTokenKind]string{
+		jsPunct: "punct", jsIdent: "ident", jsString: "string", jsNumber: "number", jsRegexp: "regexp",
+	}
+	var result []string
+	for _, tok := range tokens {
+		result = append(result, kinds[tok.kind]+" "+tok.value)
+	}
+	return result
+}
+
+func TestTokenizeJS(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"hex escape", `a="x\x41y"`, []string{"ident a", "punct =", "string xAy"}},
+		{"unicode escape", `'\u00e4'`, []string{"string \u00e4"}},
+		{"unicode code point", `"\u{1F600}"`, []string{"string \U0001F600"}},
+		{"surrogate pair", `"\ud83d\ude00"`, []string{"string \U0001F600"}},
+		{"single escapes", `"a\tb\\c\"d\'e"`, []string{"string a\tb\\c\"d'e"}},
+		{"line continuation", "\"a\\\nb\"", []string{"string ab"}},
+		{"line continuation crlf", "\"a\\\r\nb\"", []string{"string ab"}},
+		{"concatenation", `"a" + 'b' + "c"`, []string{"string abc"}},
+		{"template", "`a\\u0041${b}`", []string{"string aA${b}"}},
+		{"nested template expression", "`a${b ? {c: 1} : {d: {e: 2}}}z`",
+			[]string{"string a${b ? {c: 1} : {d: {e: 2}}}z"}},
+		{"division", `x=a/b/2`,
+			[]string{"ident x", "punct =", "ident a", "punct /", "ident b", "punct /", "number 2"}},
+		{"division after parenthesis", `(a)/2`,
+			[]string{"punct (", "ident a", "punct )", "punct /", "number 2"}},
+		{"regexp", `x=/a\/b[/]/g.test(y)`,
+			[]string{"ident x", "punct =", `regexp /a\/b[/]/g`, "punct .", "ident test", "punct (", "ident y", "punct )"}},
+		{"regexp after return", `return /"/`, []string{"ident return", `regexp /"/`}},
+		{"comments", "a /* b */ // c\nd", []string{"ident a", "ident d"}},
+		{"numbers", `1e-3 0x2a .5`, []string{"number 1e-3", "number 0x2a", "number .5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizeJS(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tokenStrings(tokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeJS(%q) = %q, erwartet %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeJSErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"abc`, "String nicht beendet"},
+		{"'a\nb'", "String nicht beendet"},
+		{`a /* b`, "Kommentar nicht beendet"},
+		{"`abc", "Template nicht beendet"},
+		{"`${a", "Ausdruck im Template nicht beendet"},
+		{`x = /abc`, "Regulärer Ausdruck nicht beendet"},
+		{`"\x4"`, `ungültige \x Sequenz`},
+		{`"\u12"`, `ungültige \u Sequenz`},
+		{`"\u{110000}"`, `ungültige \u Sequenz`},
+		{`"\u{41"`, `ungültige \u Sequenz`},
+		{`"\`, "Escape Sequenz nicht beendet"},
+	}
+	for _, tt := range tests {
+		_, err := tokenizeJS(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("tokenizeJS(%q): %v, erwartet %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestJSObjects(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []map[string]string
+	}{
+		{"strings and numbers", `{a: "x", "b": 1}`, []map[string]string{{"a": "x", "b": "1"}}},
+		{"nested", `{a: "x", b: {c: "y"}, d: "z"}`,
+			[]map[string]string{{"c": "y"}, {"a": "x", "d": "z"}}},
+		{"ternary value", `{a: b ? "x" : "y", c: "z"}`, []map[string]string{{"c": "z"}}},
+		{"ternary of objects", `x ? {a: "1"} : {a: "2"}`,
+			[]map[string]string{{"a": "1"}, {"a": "2"}}},
+		{"expression value", `{a: "x" + y, b: "z"}`, []map[string]string{{"b": "z"}}},
+		{"function body", `function f() { return {} }`, nil},
+		{"unbalanced", `} {a: "x"}`, []map[string]string{{"a": "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenizeJS(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := jsObjects(tokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jsObjects(%q) = %v, erwartet %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInfos(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  string
+		err     string
+		log     string
+		imprint string
+	}{
+		{"complete", `var e=[{paper:"az-d",title:"Dürener Zeitung",brand:"az"}],t="<h1>Impressum</h1>Verlag<br>Aachen";`,
+			"", "", "Verlag<br />Aachen"},
+		{"no imprint", `var e=[{paper:"az-d",title:"Dürener Zeitung"}];`,
+			"", "Kein Impressum", ""},
+		{"no editions", `var t="<h1>Impressum</h1>Verlag",e=[{paper:"az-d"}];`,
+			"keine Ausgaben", "", "Verlag"},
+		{"unreadable", `var t="<h1>Impressum`, "nicht lesbar", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.bundle)
+			}))
+			defer server.Close()
+			var logged bytes.Buffer
+			c := newClient()
+			c.Log = log.New(&logged, "", 0)
+			err := c.getInfos(context.Background(), server.URL+"/js/app.js")
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("err = %v, erwartet %q", err, tt.err)
+			}
+			if !strings.Contains(logged.String(), tt.log) {
+				t.Errorf("Log %q, erwartet %q", logged.String(), tt.log)
+			}
+			if c.Impressum != tt.imprint {
+				t.Errorf("Impressum = %q, erwartet %q", c.Impressum, tt.imprint)
+			}
+		})
+	}
+}
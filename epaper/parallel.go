@@ -0,0 +1,63 @@
+package epaper
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency - Number of parallel downloads used by NewClient
+const DefaultConcurrency = 4
+
+// parallel - Ruft fn für alle i von 0 bis n-1 auf, wobei höchstens
+// c.Concurrency Aufrufe gleichzeitig laufen. Der erste Fehler bricht
+// alle übrigen Aufrufe über den Context ab und wird zurückgeliefert.
+func (c *Client) parallel(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	// Aufträge verteilen, bis alle vergeben sind oder abgebrochen wurde
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,153 @@
+package epaper
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// azdlManifest - Die Quelldaten der Artikel und Bilder im ePub, damit ein
+// Neubau nur laden muss, was der Server als geändert meldet
+const azdlManifest = "META-INF/azdl.json"
+
+// epubManifest - Der Inhalt von azdlManifest
+type epubManifest struct {
+	Paper   string `json:"paper"`
+	Date    string `json:"date"`
+	Version int    `json:"version"`
+	// Articles - Die Artikel je articleKey
+	Articles map[string]storedArticle `json:"articles"`
+	// Pictures - Die Bilder je Dateiname im ePub
+	Pictures map[string]validators `json:"pictures"`
+}
+
+// storedArticle - Die Antwort der API für einen Artikel auf einer Seite
+type storedArticle struct {
+	Validators validators      `json:"validators"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// articleKey - Ein Artikel auf einer Seite. Derselbe Artikel kann auf
+// mehreren Seiten stehen und hat dann je Seite andere Daten.
+func articleKey(seite int, id string) string {
+	return strconv.Itoa(seite) + "/" + id
+}
+
+// validators - ETag und Last-Modified einer Antwort. Damit fragt ein
+// Neubau beim Server nach, ob sich die Antwort geändert hat. Ohne sie
+// wird immer geladen, die IDs allein sagen nichts über den Inhalt.
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func responseValidators(response *http.Response) validators {
+	return validators{
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+}
+
+func (v validators) known() bool {
+	return v.ETag != "" || v.LastModified != ""
+}
+
+// set - Macht request zu einer bedingten Anfrage, die der Server mit
+// 304 beantwortet, wenn sich nichts geändert hat
+func (v validators) set(request *http.Request) {
+	if v.ETag != "" {
+		request.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		request.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// previousEpub - Das zuletzt geschriebene ePub derselben Ausgabe und
+// desselben Tages. Ein nil *previousEpub ist leer.
+type previousEpub struct {
+	zr       *zip.ReadCloser
+	manifest epubManifest
+	files    map[string]*zip.File
+}
+
+// openPrevious - Öffnet das vorige ePub filename, wenn es für paper
+// am date geschrieben wurde. Sonst gibt es nil.
+func openPrevious(filename, paper, date string) *previousEpub {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil
+	}
+	p := &previousEpub{zr: zr, files: map[string]*zip.File{}}
+	for _, f := range zr.File {
+		p.files[f.Name] = f
+	}
+	if err := p.readJSON(azdlManifest, &p.manifest); err != nil ||
+		p.manifest.Paper != paper || p.manifest.Date != date {
+		// Ein ePub einer älteren azdl Version oder einer anderen Ausgabe
+		zr.Close()
+		return nil
+	}
+	return p
+}
+
+func (p *previousEpub) readJSON(name string, v interface{}) error {
+	f, ok := p.files[name]
+	if !ok {
+		return fmt.Errorf("%s fehlt", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(v)
+}
+
+// article - Die Antwort für den Artikel key aus dem vorigen ePub oder nil
+func (p *previousEpub) article(key string) *storedArticle {
+	if p == nil {
+		return nil
+	}
+	stored, ok := p.manifest.Articles[key]
+	if !ok || !stored.Validators.known() {
+		return nil
+	}
+	return &stored
+}
+
+// picture - Das Bild name aus dem vorigen ePub oder nil. Verwendet wird
+// es nur, wenn der Server es als unverändert meldet.
+func (p *previousEpub) picture(name string) *download {
+	if p == nil {
+		return nil
+	}
+	v, ok := p.manifest.Pictures[name]
+	if !ok || !v.known() {
+		return nil
+	}
+	f, ok := p.files[name]
+	if !ok {
+		return nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return &download{size: int64(len(data)), data: data, validators: v}
+}
+
+func (p *previousEpub) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.zr.Close()
+}
@@ -0,0 +1,222 @@
+package epaper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// redacted - Ersetzt Zugangsdaten und Autorisierung in Aufzeichnungen
+const redacted = "REDACTED"
+
+// exchange - Ein aufgezeichneter Request mit seiner Antwort
+type exchange struct {
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	RequestHeader http.Header `json:"requestHeader,omitempty"`
+	RequestBody   string      `json:"requestBody,omitempty"`
+	Status        int         `json:"status"`
+	Header        http.Header `json:"header,omitempty"`
+	// Body - Die Antwort als Text oder, wenn sie kein UTF-8 ist
+	// (Bilder), in BodyBase64
+	Body       string `json:"body,omitempty"`
+	BodyBase64 []byte `json:"bodyBase64,omitempty"`
+}
+
+// RecordTransport - Saves every request and its response to Dir.
+// Credentials, the Authorization header and cookies are redacted,
+// so the recordings can be shared.
+type RecordTransport struct {
+	// Dir receives one JSON file per request, numbered in order
+	Dir string
+	// Next does the actual requests. Nil means http.DefaultTransport.
+	Next http.RoundTripper
+
+	mu    sync.Mutex
+	count int
+}
+
+func (t *RecordTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		if requestBody, err = ioutil.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	response, err := next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	x := exchange{
+		Method:        request.Method,
+		URL:           request.URL.String(),
+		RequestHeader: redactHeader(request.Header, "Authorization", "Cookie"),
+		RequestBody:   string(redactJSON(requestBody, "login", "password")),
+		Status:        response.StatusCode,
+		Header:        redactHeader(response.Header, "Set-Cookie"),
+	}
+	// Die Länge stimmt nach dem Unkenntlichmachen eventuell nicht mehr
+	x.Header.Del("Content-Length")
+	data = redactJSON(data, "authorizationHeader")
+	if utf8.Valid(data) {
+		x.Body = string(data)
+	} else {
+		x.BodyBase64 = data
+	}
+	if err := t.save(x); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (t *RecordTransport) save(x exchange) error {
+	t.mu.Lock()
+	t.count++
+	n := t.count
+	t.mu.Unlock()
+	data, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(t.Dir, fmt.Sprintf("%05d.json", n)), data, 0644)
+}
+
+// redactHeader - Eine Kopie von header ohne die Werte von names
+func redactHeader(header http.Header, names ...string) http.Header {
+	header = header.Clone()
+	for _, name := range names {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	return header
+}
+
+// redactJSON - Ersetzt die Werte von keys in einem JSON Objekt.
+// Andere Daten bleiben unverändert.
+func redactJSON(data []byte, keys ...string) []byte {
+	var object map[string]interface{}
+	if json.Unmarshal(data, &object) != nil {
+		return data
+	}
+	changed := false
+	for _, key := range keys {
+		if _, ok := object[key]; ok {
+			object[key] = redacted
+			changed = true
+		}
+	}
+	if !changed {
+		return data
+	}
+	redactedData, err := json.Marshal(object)
+	if err != nil {
+		return data
+	}
+	return redactedData
+}
+
+// ReplayTransport - Answers requests with the responses recorded by
+// RecordTransport, without any network access
+type ReplayTransport struct {
+	mu sync.Mutex
+	// recorded - Die Antworten je Methode und URL in der Reihenfolge
+	// der Aufzeichnung. Die letzte wird beliebig oft wiederholt.
+	recorded map[string][]exchange
+}
+
+// NewReplayTransport - Loads the recordings in dir
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("keine Aufzeichnungen in %s", dir)
+	}
+	// Die Dateien sind durchnummeriert
+	sort.Slice(files, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(files[i]), ".json"))
+		b, _ := strconv.Atoi(strings.TrimSuffix(filepath.Base(files[j]), ".json"))
+		return a < b
+	})
+	t := &ReplayTransport{recorded: map[string][]exchange{}}
+	for _, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var x exchange
+		if err := json.Unmarshal(data, &x); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		key := x.Method + " " + x.URL
+		t.recorded[key] = append(t.recorded[key], x)
+	}
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	key := request.Method + " " + request.URL.String()
+	t.mu.Lock()
+	queue := t.recorded[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%s: nicht aufgezeichnet", key)
+	}
+	x := queue[0]
+	if len(queue) > 1 {
+		t.recorded[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	body := []byte(x.Body)
+	if x.BodyBase64 != nil {
+		body = x.BodyBase64
+	}
+	header := x.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(x.Status) + " " + http.StatusText(x.Status),
+		StatusCode:    x.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}, nil
+}
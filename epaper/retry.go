@@ -0,0 +1,159 @@
+package epaper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - Determines how often and when failed requests are repeated
+type RetryPolicy struct {
+	// Attempts is the total number of attempts per request
+	Attempts int
+	// MinBackoff is the wait time after the first failure.
+	// It doubles with every further failure.
+	MinBackoff time.Duration
+	// MaxBackoff limits the wait time, including Retry-After
+	MaxBackoff time.Duration
+	// RetryStatus lists the HTTP status codes worth a retry
+	RetryStatus []int
+}
+
+// DefaultRetryPolicy - The retry policy used by NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+	RetryStatus: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+func (p *RetryPolicy) retryable(status int) bool {
+	for _, s := range p.RetryStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff - Wartezeit vor dem Versuch attempt+1 mit "equal jitter":
+// die halbe Wartezeit fest, die andere Hälfte zufällig
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.MinBackoff
+	for i := 1; i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// retryAfter - Wertet den Retry-After Header aus (Sekunden oder HTTP-Datum)
+func retryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// doRetry - Führt request mit den aktuellen Headern des Clients aus und
+// liest die Antwort vollständig. Netzwerkfehler und die Statuscodes
+// aus c.Retry.RetryStatus führen zu weiteren Versuchen.
+// Der Body der Antwort ist bereits geschlossen. Statuscodes ab 400
+// werden nach dem letzten Versuch als APIError geliefert.
+func (c *Client) doRetry(request *http.Request) (*http.Response, []byte, error) {
+	ctx := request.Context()
+	attempts := c.Retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	// Eigene Header des Requests wie If-None-Match bleiben erhalten,
+	// die des Clients gehen aber vor
+	own := request.Header
+	for attempt := 1; ; attempt++ {
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, nil, err
+			}
+			request.Body = body
+		}
+		header := c.header()
+		for key, values := range own {
+			if _, ok := header[key]; !ok {
+				header[key] = values
+			}
+		}
+		request.Header = header
+
+		var (
+			data   []byte
+			reason error
+		)
+		response, err := c.C.Do(request)
+		if err == nil {
+			data, err = ioutil.ReadAll(response.Body)
+			response.Body.Close()
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil, nil, ctx.Err()
+		case err != nil:
+			reason = err
+		case c.Retry.retryable(response.StatusCode):
+			reason = fmt.Errorf("HTTP %s", response.Status)
+		default:
+			return response, data, checkStatus(response, data)
+		}
+		if attempt >= attempts {
+			if err != nil {
+				return nil, nil, err
+			}
+			return response, data, checkStatus(response, data)
+		}
+
+		wait := c.Retry.backoff(attempt)
+		if response != nil {
+			if after, ok := retryAfter(response); ok {
+				wait = after
+				if wait > c.Retry.MaxBackoff {
+					wait = c.Retry.MaxBackoff
+				}
+			}
+		}
+		c.logf("%s %s: Versuch %d/%d fehlgeschlagen (%v), nächster Versuch in %s",
+			request.Method, request.URL, attempt, attempts, reason, wait.Round(time.Millisecond))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package epaper
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedElements - Die Elemente, die mit ihren Attributen übernommen
+// werden. Dazu kommen immer class und title.
+var allowedElements = map[string][]string{
+	"p": nil, "br": nil, "hr": nil, "div": nil, "span": nil,
+	"b": nil, "strong": nil, "i": nil, "em": nil, "u": nil, "s": nil,
+	"sub": nil, "sup": nil, "small": nil, "abbr": nil, "cite": nil, "q": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"blockquote": nil, "pre": nil, "code": nil,
+	"ul": nil, "ol": {"start"}, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+	"table": nil, "caption": nil, "thead": nil, "tbody": nil, "tfoot": nil,
+	"tr": nil, "th": {"colspan", "rowspan"}, "td": {"colspan", "rowspan"},
+	"figure": nil, "figcaption": nil,
+	"a": {"href"},
+}
+
+// removedElements - Elemente, die samt Inhalt entfernt werden: Skripte,
+// eingebettete Seiten, Formulare und Ressourcen aus dem Netz. Die Bilder
+// der Artikel kommen aus Article.Pictures.
+var removedElements = map[string]bool{
+	"script": true, "noscript": true, "style": true, "template": true,
+	"iframe": true, "frame": true, "frameset": true, "object": true,
+	"embed": true, "applet": true, "param": true,
+	"img": true, "picture": true, "source": true, "audio": true,
+	"video": true, "track": true, "canvas": true, "map": true, "area": true,
+	"svg": true, "math": true,
+	"link": true, "meta": true, "base": true, "title": true, "head": true,
+	"form": true, "input": true, "button": true, "select": true,
+	"textarea": true, "option": true, "label": true,
+}
+
+// allowedClasses - Die Klassen, die das Stylesheet kennt
+var allowedClasses = map[string]bool{
+	"ortsmarke":              true,
+	"quote":                  true,
+	"box":                    true,
+	"IR_AZAN-Infobox_Balken": true,
+	"fotocredit":             true,
+}
+
+// ignoredAttribute - Attribute, die ohne Meldung entfernt werden:
+// Event Handler, Formatierungen und Sprungziele
+func ignoredAttribute(key string) bool {
+	switch key {
+	case "style", "target", "id", "align", "width", "height", "rel":
+		return true
+	}
+	return strings.HasPrefix(key, "on")
+}
+
+// sanitize - Entfernt aus den Kindern von n alles, was nicht erlaubt ist.
+// Unbekannte Elemente verlieren nur ihr Tag. Unbekannte Elemente,
+// Attribute und Klassen werden an report gemeldet.
+func sanitize(n *html.Node, report func(construct string)) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.ElementNode:
+			sanitizeElement(c, report)
+		case html.TextNode:
+		default:
+			// Kommentare und Doctype
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func sanitizeElement(n *html.Node, report func(construct string)) {
+	if removedElements[n.Data] || n.Namespace != "" {
+		n.Parent.RemoveChild(n)
+		return
+	}
+	allowed, ok := allowedElements[n.Data]
+	if !ok {
+		report("<" + n.Data + ">")
+		sanitize(n, report)
+		for c := n.FirstChild; c != nil; c = n.FirstChild {
+			n.RemoveChild(c)
+			n.Parent.InsertBefore(c, n)
+		}
+		n.Parent.RemoveChild(n)
+		return
+	}
+
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		switch {
+		case a.Namespace != "" || ignoredAttribute(a.Key):
+		case a.Key == "class":
+			if a.Val = allowedClassList(a.Val, report); a.Val != "" {
+				attrs = append(attrs, a)
+			}
+		case a.Key == "href":
+			// Nur Links ins Netz, relative führen im ePub ins Leere
+			if u, err := url.Parse(strings.TrimSpace(a.Val)); err == nil &&
+				(u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto") {
+				attrs = append(attrs, a)
+			}
+		case a.Key == "title" || contains(allowed, a.Key):
+			attrs = append(attrs, a)
+		default:
+			report(a.Key + " in <" + n.Data + ">")
+		}
+	}
+	n.Attr = attrs
+	sanitize(n, report)
+}
+
+// allowedClassList - Die erlaubten Klassen aus classes
+func allowedClassList(classes string, report func(construct string)) string {
+	var result []string
+	for _, class := range strings.Fields(classes) {
+		if allowedClasses[class] {
+			result = append(result, class)
+		} else {
+			report("class " + class)
+		}
+	}
+	return strings.Join(result, " ")
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
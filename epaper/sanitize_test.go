@@ -0,0 +1,47 @@
+package epaper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		unknown        []string
+	}{
+		{"allowed classes",
+			`<p><b class="ortsmarke">Aachen</b></p><div class="box"><p class="quote">„Ja“</p></div>` +
+				`<p class="IR_AZAN-Infobox_Balken">Info</p><span class="fotocredit">Foto: dpa</span>`,
+			`<p><b class="ortsmarke">Aachen</b></p><div class="box"><p class="quote">„Ja“</p></div>` +
+				`<p class="IR_AZAN-Infobox_Balken">Info</p><span class="fotocredit">Foto: dpa</span>`,
+			nil},
+		{"script and style", `<p>a<script>alert(1)</script><style>p{}</style>b</p>`, `<p>ab</p>`, nil},
+		{"iframe", `<p>Video:</p><iframe src="https://example.com/embed"></iframe>`, `<p>Video:</p>`, nil},
+		{"event handlers and style", `<p onclick="x()" onMouseOver="y()" style="color:red">a</p>`, `<p>a</p>`, nil},
+		{"remote image", `<p><img src="https://tracker.example/pixel.gif">a</p>`, `<p>a</p>`, nil},
+		{"javascript link", `<a href="javascript:alert(1)">a</a>`, `<a>a</a>`, nil},
+		{"relative link", `<a href="/article/1">a</a>`, `<a>a</a>`, nil},
+		{"mailto link", `<a href="mailto:leser@example.com">a</a>`, `<a href="mailto:leser@example.com">a</a>`, nil},
+		{"svg", `<p>a<svg><circle r="1"/></svg>b</p>`, `<p>ab</p>`, nil},
+		{"unknown element", `<p><font color="red">rot</font></p>`, `<p>rot</p>`, []string{"<font>"}},
+		{"unknown class", `<p class="quote neu">a</p>`, `<p class="quote">a</p>`, []string{"class neu"}},
+		{"unknown attribute", `<p data-x="1">a</p>`, `<p>a</p>`, []string{"data-x in <p>"}},
+		{"table", `<table><tr><td colspan="2" bgcolor="red">a</td></tr></table>`,
+			`<table><tbody><tr><td colspan="2">a</td></tr></tbody></table>`, []string{"bgcolor in <td>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unknown []string
+			got := xhtml(tt.in, func(construct string) {
+				unknown = append(unknown, construct)
+			})
+			if got != tt.want {
+				t.Errorf("xhtml(%q) = %q, erwartet %q", tt.in, got, tt.want)
+			}
+			if !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("gemeldet %q, erwartet %q", unknown, tt.unknown)
+			}
+		})
+	}
+}
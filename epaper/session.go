@@ -0,0 +1,90 @@
+package epaper
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// session - Eine gespeicherte Anmeldung
+type session struct {
+	Authorization string    `json:"authorization"`
+	Acquired      time.Time `json:"acquired"`
+}
+
+// DefaultTokenCache - The default location of the session cache file
+func DefaultTokenCache() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azdl", "session.json"), nil
+}
+
+// readSessions - Liest alle gespeicherten Anmeldungen, je Login
+func readSessions(filename string) (map[string]session, error) {
+	sessions := map[string]session{}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// cachedSession - Die gespeicherte Anmeldung für die aktuellen Zugangsdaten
+func (c *Client) cachedSession() (session, bool) {
+	if c.TokenCache == "" {
+		return session{}, false
+	}
+	sessions, err := readSessions(c.TokenCache)
+	if err != nil {
+		c.logf("Session Cache %s nicht lesbar: %v", c.TokenCache, err)
+		return session{}, false
+	}
+	s, ok := sessions[c.credentials.Login]
+	return s, ok && s.Authorization != ""
+}
+
+// storeSession - Speichert die Anmeldung für die aktuellen Zugangsdaten.
+// Fehler werden nur protokolliert, die Anmeldung selbst war ja erfolgreich.
+func (c *Client) storeSession(authorization string) {
+	if c.TokenCache == "" {
+		return
+	}
+	sessions, err := readSessions(c.TokenCache)
+	if err != nil {
+		sessions = map[string]session{}
+	}
+	sessions[c.credentials.Login] = session{
+		Authorization: authorization,
+		Acquired:      time.Now().UTC(),
+	}
+	if err := writeJSON(c.TokenCache, sessions); err != nil {
+		c.logf("Session Cache %s nicht schreibbar: %v", c.TokenCache, err)
+	}
+}
+
+// writeJSON - Schreibt v nur für den Benutzer lesbar über eine
+// temporäre Datei, damit nie eine halbe Datei entsteht
+func writeJSON(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename, 0600, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
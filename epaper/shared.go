@@ -0,0 +1,127 @@
+package epaper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// shared - Downloads, die mehrere Ausgaben gemeinsam nutzen. Lokalausgaben
+// enthalten viele Artikel und Bilder des Mantels mit denselben IDs.
+type shared struct {
+	mu sync.Mutex
+	// date - Es werden nur die Downloads eines Tages vorgehalten
+	date     string
+	articles map[string]sharedArticle
+	pictures map[string]*download
+}
+
+// sharedArticle - Die Antwort der API für einen Artikel und die Ausgabe,
+// für die er geladen wurde
+type sharedArticle struct {
+	edition string
+	data    []byte
+}
+
+// shareDate - Verwirft die gemeinsamen Downloads, wenn sich das Datum ändert
+func (c *Client) shareDate(date string) {
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	if c.shared.date != date {
+		c.shared.date = date
+		c.shared.articles = nil
+		c.shared.pictures = nil
+	}
+}
+
+// getArticle - Lädt den Artikel id von relativeURL. Wurde er bereits für
+// eine andere Ausgabe geladen, wird diese Antwort verwendet und reused
+// ist true. Innerhalb einer Ausgabe wird immer neu geladen, da die API
+// die Platzierung des Artikels auf der angefragten Seite liefert.
+// Ist previous die Antwort aus dem vorigen ePub, wird sie verwendet und
+// unchanged ist true, wenn der Server sie als unverändert meldet.
+// source ist die Antwort für den nächsten Neubau.
+func (c *Client) getArticle(ctx context.Context, id, relativeURL string, previous *storedArticle, artikel *Article) (source storedArticle, reused, unchanged bool, err error) {
+	c.shared.mu.Lock()
+	cached, ok := c.shared.articles[id]
+	c.shared.mu.Unlock()
+	if ok && cached.edition != c.Ausgabe && json.Unmarshal(cached.data, artikel) == nil {
+		return storedArticle{}, true, false, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", c.NewspaperURL+"/"+relativeURL, nil)
+	if err != nil {
+		return storedArticle{}, false, false, err
+	}
+	if previous != nil {
+		previous.Validators.set(request)
+	}
+	response, data, err := c.do(request)
+	if err != nil {
+		return storedArticle{}, false, false, err
+	}
+	if previous != nil && response.StatusCode == http.StatusNotModified {
+		source, unchanged = *previous, true
+	} else {
+		source = storedArticle{responseValidators(response), data}
+	}
+	if err := decodeJSON(response, source.Data, artikel); err != nil {
+		return storedArticle{}, false, false, err
+	}
+
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	if c.shared.articles == nil {
+		c.shared.articles = map[string]sharedArticle{}
+	}
+	c.shared.articles[id] = sharedArticle{c.Ausgabe, source.Data}
+	return source, false, unchanged, nil
+}
+
+// loadPicture - Wie loadIfModified, aber jedes Bild wird nur einmal geladen
+func (c *Client) loadPicture(ctx context.Context, id, relativeURL string, previous *download) (*download, error) {
+	c.shared.mu.Lock()
+	cached, ok := c.shared.pictures[id]
+	c.shared.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	d, err := c.loadIfModified(ctx, relativeURL, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	if c.shared.pictures == nil {
+		c.shared.pictures = map[string]*download{}
+	}
+	c.shared.pictures[id] = d
+	return d, nil
+}
+
+// relocate - Verschiebt einen für eine andere Ausgabe geladenen Artikel auf
+// seine Seite in dieser Ausgabe. Vorgänger und Nachfolger werden um
+// denselben Abstand verschoben, damit die Reihenfolge erhalten bleibt.
+func (a *Article) relocate(zeitung *Ausgabe, seite *Seite) {
+	delta := seite.Index - a.Paper.Page.Index
+	a.Paper.Paper = zeitung.Paper
+	a.Paper.Title = zeitung.Title
+	a.Paper.Page = Page{
+		ID:     seite.ID,
+		Index:  seite.Index,
+		Number: seite.Number,
+		Title:  seite.Title,
+	}
+	for _, link := range []*Link{&a.Prev, &a.Next} {
+		if link.ID == "" {
+			continue
+		}
+		link.Paper.Paper = zeitung.Paper
+		link.Paper.Title = zeitung.Title
+		link.Paper.Page.Index += delta
+		link.Paper.Page.Number += delta
+	}
+}
@@ -0,0 +1,124 @@
+package epaper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// issueState - Was über eine geschriebene Ausgabe festgehalten wird
+type issueState struct {
+	Version  int       `json:"version"`
+	Filename string    `json:"filename"`
+	Written  time.Time `json:"written"`
+	// Articles - Die Prüfsumme jedes Artikels, je ID
+	Articles map[string]string `json:"articles"`
+}
+
+// DefaultStateFile - The default location of the state file
+func DefaultStateFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "azdl", "state.json"), nil
+}
+
+// stateKey - Eine Ausgabe an einem Tag, z.B. az-d/20200821
+func stateKey(edition, date string) string {
+	return edition + "/" + date
+}
+
+// readStates - Liest den Stand aller geschriebenen Ausgaben
+func readStates(filename string) (map[string]issueState, error) {
+	states := map[string]issueState{}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// issueState - Der Stand, in dem die Ausgabe zuletzt geschrieben wurde
+func (c *Client) issueState(key string) (issueState, bool) {
+	if c.StateFile == "" {
+		return issueState{}, false
+	}
+	states, err := readStates(c.StateFile)
+	if err != nil {
+		c.logf("Statusdatei %s nicht lesbar: %v", c.StateFile, err)
+		return issueState{}, false
+	}
+	state, ok := states[key]
+	return state, ok
+}
+
+// storeIssueState - Hält fest, in welchem Stand die Ausgabe geschrieben
+// wurde. Fehler werden nur protokolliert, das ePub gibt es ja.
+func (c *Client) storeIssueState(key string, state issueState) {
+	if c.StateFile == "" {
+		return
+	}
+	states, err := readStates(c.StateFile)
+	if err != nil {
+		states = map[string]issueState{}
+	}
+	states[key] = state
+	if err := writeJSON(c.StateFile, states); err != nil {
+		c.logf("Statusdatei %s nicht schreibbar: %v", c.StateFile, err)
+	}
+}
+
+// upToDate - Ist das ePub filename bereits in dieser Version geschrieben?
+func (s issueState) upToDate(version int, filename string) bool {
+	if s.Version < version || s.Filename != filename {
+		return false
+	}
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// changes - Zählt die neuen, geänderten und entfallenen Artikel
+func (s issueState) changes(articles map[string]string) (added, changed, removed int) {
+	for id, sum := range articles {
+		old, ok := s.Articles[id]
+		switch {
+		case !ok:
+			added++
+		case old != sum:
+			changed++
+		}
+	}
+	for id := range s.Articles {
+		if _, ok := articles[id]; !ok {
+			removed++
+		}
+	}
+	return added, changed, removed
+}
+
+// checksum - Die Prüfsumme über den Inhalt des Artikels, ohne die
+// Platzierung auf der Seite
+func (a *Article) checksum() string {
+	h := sha256.New()
+	for _, s := range []string{a.Title, a.Author, a.Underline, a.Headline, a.Location, a.Text} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	for _, picture := range a.Pictures {
+		h.Write([]byte(picture.ID))
+		h.Write([]byte(picture.Description))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -0,0 +1,128 @@
+package epaper
+
+// Ausgabe - The base data of a newspaper's release
+type Ausgabe struct {
+	Paper        string   `json:"paper"`         // az-d
+	Title        string   `json:"title"`         // Dürener Zeitung
+	Date         int      `json:"date"`          // 20060102
+	Brand        string   `json:"brand"`         // az
+	Pages        int      `json:"numberOfPages"` // 14
+	Titles       []string `json:"pageTitles"`    // ["TITELSEITE", "POLITIK"…]
+	Subscription bool     `json:"subscription"`  // true
+	Bought       bool     `json:"bought"`        // false
+	Version      int      `json:"version"`       // 1598303355
+}
+
+// Edition - An edition of the newspaper as listed in the app bundle
+type Edition struct {
+	Paper string `json:"paper"` // az-d
+	Title string `json:"title"` // Dürener Zeitung
+	Brand string `json:"brand"` // az
+	// Fields holds all string and number properties of the edition
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Seite - A single page of a release
+type Seite struct {
+	ID       string    `json:"id"`       //  "20200820-47208377",
+	Title    string    `json:"title"`    //  "DIE SEITE DREI",
+	Number   int       `json:"number"`   //  3,
+	Index    int       `json:"index"`    //  2,
+	Width    int       `json:"width"`    //  351,
+	Height   int       `json:"height"`   //  506,
+	Elements []Element `json:"elements"` //
+	Free     bool      `json:"free"`     //  false
+	Sequence []Element
+}
+
+// Element - An element (article, ad, picture…) placed on a page
+type Element struct {
+	ID        string `json:"id"`        //  "88937601",
+	XStart    int    `json:"xStart"`    //  12,
+	XEnd      int    `json:"xEnd"`      //  283,
+	YStart    int    `json:"yStart"`    //  45,
+	YEnd      int    `json:"yEnd"`      //  492,
+	Area      int    `json:"area"`      //  121137,
+	Width     int    `json:"width"`     //  620,
+	Height    int    `json:"height"`    //  1024,
+	Type      string `json:"type"`      //  "article",
+	Title     string `json:"title"`     //  "Corona-Hotspot Innenraum",
+	Author    string `json:"author"`    //  "",
+	Underline string `json:"underline"` //  "An der frischen Luft …"
+	Headline  string `json:"headline"`  //  "",
+	Location  string `json:"location"`  //  ""
+	Article   *Article
+	Pictures  []Picture
+}
+
+// Picture - A picture belonging to an article
+type Picture struct {
+	ID          string `json:"id"`          //  "2094290259_e7c39b54a0.irprodgera_i14u8q",
+	XStart      int    `json:"xStart"`      //  12,
+	XEnd        int    `json:"xEnd"`        //  62,
+	YStart      int    `json:"yStart"`      //  57,
+	YEnd        int    `json:"yEnd"`        //  93,
+	Area        int    `json:"area"`        //  1800,
+	Width       int    `json:"width"`       //  600,
+	Height      int    `json:"height"`      //  429,
+	Type        string `json:"type"`        //  "picture",
+	Description string `json:"description"` //  null
+	Size        int64
+	Filename    string
+}
+
+// Page - The short reference to a page
+type Page struct {
+	ID     string `json:"id"`     // "20200821-47213513",
+	Index  int    `json:"index"`  // 11,
+	Number int    `json:"number"` // 12,
+	Title  string `json:"title"`  // "LOKALES"
+}
+
+// Link - Reference to the previous or next article
+type Link struct {
+	ID    string `json:"id"`
+	Paper Paper  `json:"paper"`
+}
+
+// Paper - Where an article is located
+type Paper struct {
+	Paper string `json:"paper"` // "az-d",
+	Date  string `json:"date"`  // "20200821",
+	Title string `json:"title"` // "D\u00fcrener Zeitung",
+	Page  Page   `json:"page"`
+}
+
+// Article - A newspaper article
+type Article struct {
+	ID         string    `json:"id"`        //  "88973299",
+	XStart     int       `json:"xStart"`    //  12,
+	XEnd       int       `json:"xEnd"`      //  109,
+	YStart     int       `json:"yStart"`    //  57,
+	YEnd       int       `json:"yEnd"`      //  93,
+	Area       int       `json:"area"`      //  3492,
+	Width      int       `json:"width"`     //  570,
+	Height     int       `json:"height"`    //  209,
+	Type       string    `json:"type"`      //  "article",
+	Title      string    `json:"title"`     //  "",
+	Author     string    `json:"author"`    //  "",
+	Underline  string    `json:"underline"` //  "",
+	Headline   string    `json:"headline"`  //  "",
+	Location   string    `json:"location"`  //  "",
+	Pictures   []Picture `json:"pictures"`
+	Paper      Paper     `json:"paper"`
+	Text       string    `json:"text"`       //  "<p>Joe Biden<\/p><p>Der Mann, der Donald Trump<br \/>als US-Pr\u00e4sident abl\u00f6sen will<\/p><p>Die Seite Drei<\/p>",
+	Sociallink string    `json:"sociallink"` //  "https:\/\/epaper.zeitungsverlag-aachen.de\/2.0\/article\/327f34db08",
+	Print      string    `json:"print"`      //  "https:\/\/epaper.zeitungsverlag-aachen.de\/2.0\/article\/327f34db08",
+	Wordcount  int       `json:"wordcount"`  //  13
+	Prev       Link      `json:"prev"`
+	Next       Link      `json:"next"`
+	XMLID      string
+	AltTitle   string
+	Filename   string
+}
+
+type pgInfo struct {
+	Title string
+	Index int
+}
@@ -0,0 +1,100 @@
+package epaper
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"hradek.net/azdl/templates"
+)
+
+// voidElements - Elemente ohne Inhalt, die in XHTML mit /> enden
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// xhtml - Wandelt das HTML der API in wohlgeformtes XHTML um. Der Text
+// wird wie im Browser geparst: benannte Entities werden zu Zeichen, nicht
+// geschlossene Elemente werden geschlossen und leere wie <br> enden
+// mit />. Was nicht erlaubt ist, entfernt sanitize und meldet
+// Unbekanntes an report, sofern nicht nil.
+func xhtml(text string, report func(construct string)) string {
+	if text == "" {
+		return ""
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(text), body)
+	if err != nil {
+		// Kann bei einem strings.Reader nicht passieren
+		return templates.XMLEscape(text)
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	if report == nil {
+		report = func(string) {}
+	}
+	sanitize(body, report)
+	ortsmarke(body)
+	var b strings.Builder
+	writeChildren(&b, body)
+	return b.String()
+}
+
+func writeXHTML(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(templates.XMLEscape(n.Data))
+	case html.ElementNode:
+		b.WriteString("<" + n.Data)
+		for _, a := range n.Attr {
+			b.WriteString(" " + a.Key + `="` + templates.XMLEscape(a.Val) + `"`)
+		}
+		if voidElements[n.Data] {
+			b.WriteString("/>")
+			return
+		}
+		b.WriteString(">")
+		writeChildren(b, n)
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+func writeChildren(b *strings.Builder, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeXHTML(b, c)
+	}
+}
+
+// ortsmarke - Die Leerzeichen am Ende der Ortsmarke gehören hinter sie
+func ortsmarke(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ortsmarke(c)
+	}
+	if n.Type != html.ElementNode || !hasClass(n, "ortsmarke") ||
+		n.LastChild == nil || n.LastChild.Type != html.TextNode {
+		return
+	}
+	text := n.LastChild.Data
+	trimmed := strings.TrimRight(text, " ")
+	if trimmed == text || trimmed == "" {
+		return
+	}
+	n.LastChild.Data = trimmed
+	n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[len(trimmed):]}, n.NextSibling)
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "class" {
+			for _, c := range strings.Fields(a.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package epaper
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "", ""},
+		{"br", "eins<br>zwei<BR >drei", "eins<br/>zwei<br/>drei"},
+		{"hr", `<p>eins</p><hr>`, `<p>eins</p><hr/>`},
+		{"unclosed p", "<p>eins<p>zwei", "<p>eins</p><p>zwei</p>"},
+		{"entities", "&auml;&nbsp;&euro; &amp; &lt;", "ä\u00a0€ &amp; &lt;"},
+		{"bare ampersand", "Müller & Söhne", "Müller &amp; Söhne"},
+		{"link target", `<a href="https://example.com/?a=1&b=2" target="_blank">x</a>`,
+			`<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"ortsmarke", `<p><b class="ortsmarke">Düren </b>Der Rat</p>`,
+			`<p><b class="ortsmarke">Düren</b> Der Rat</p>`},
+		{"comment", "a<!-- intern -->b", "ab"},
+		{"control characters", "a\x00b\x0bc\td", "abc\td"},
+		{"word namespace", "<p>a<o:p></o:p>b</p>", "<p>ab</p>"},
+		{"attribute quotes", `<span title='sagt "hallo"'>x</span>`, `<span title="sagt &quot;hallo&quot;">x</span>`},
+		{"stray end tag", "a</div>b</p>", "ab<p></p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := xhtml(tt.in, nil)
+			if got != tt.want {
+				t.Errorf("xhtml(%q) = %q, erwartet %q", tt.in, got, tt.want)
+			}
+			// Das Ergebnis muss wohlgeformt sein
+			decoder := xml.NewDecoder(strings.NewReader("<div>" + got + "</div>"))
+			for {
+				_, err := decoder.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("%q ist kein XML: %v", got, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package epubcheck
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path"
+)
+
+// link - Ein Verweis href in der Datei from
+type link struct {
+	from string
+	href string
+}
+
+// linkAttributes - Die Attribute, die je Element auf eine Datei verweisen
+var linkAttributes = map[string]string{
+	"a":       "href",
+	"link":    "href",
+	"img":     "src",
+	"content": "src", // toc.ncx
+}
+
+// checkContents - Prüft alle XHTML Dateien und die toc.ncx und danach
+// die Verweise zwischen den Dateien
+func (c *checker) checkContents(pkg *opfPackage) {
+	for _, it := range pkg.Items {
+		if _, ok := c.files[it.path]; !ok {
+			continue
+		}
+		switch it.MediaType {
+		case "application/xhtml+xml", "application/x-dtbncx+xml":
+			c.checkXML(it.path)
+		}
+	}
+	c.checkLinks()
+}
+
+// checkXML - Die Datei muss wohlgeformt sein. Ohne DTD sind nur die
+// fünf vordefinierten Entities erlaubt, &nbsp; also nicht.
+// ids und Verweise werden gesammelt.
+func (c *checker) checkXML(name string) {
+	content, err := readFile(c.files[name])
+	if err != nil {
+		c.problem(name, "nicht lesbar: %v", err)
+		return
+	}
+	ids := map[string]bool{}
+	c.ids[name] = ids
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			c.problem(name, "ist kein wohlgeformtes XML: %v", err)
+			return
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range element.Attr {
+			switch {
+			case attr.Name.Local == "id" && attr.Name.Space == "":
+				if ids[attr.Value] {
+					c.problem(name, "id %s mehrfach vergeben", attr.Value)
+				}
+				ids[attr.Value] = true
+			case attr.Name.Local == linkAttributes[element.Name.Local] && attr.Name.Space == "":
+				c.links = append(c.links, link{name, attr.Value})
+			}
+		}
+	}
+}
+
+// checkLinks - Interne Verweise müssen auf vorhandene Dateien und,
+// sofern die Datei geprüft wurde, auf vorhandene Anker zeigen.
+// Externe Verweise werden nicht geprüft.
+func (c *checker) checkLinks() {
+	for _, l := range c.links {
+		u, err := url.Parse(l.href)
+		if err != nil {
+			c.problem(l.from, "ungültiger Verweis %q", l.href)
+			continue
+		}
+		if u.Scheme != "" {
+			continue
+		}
+		target := l.from
+		if u.Path != "" || u.Host != "" {
+			if target = resolve(path.Dir(l.from), l.href); target == "" {
+				c.problem(l.from, "ungültiger Verweis %q", l.href)
+				continue
+			}
+		}
+		if _, ok := c.files[target]; !ok {
+			c.problem(l.from, "Verweis auf %s führt ins Leere", target)
+			continue
+		}
+		if ids, ok := c.ids[target]; ok && u.Fragment != "" && !ids[u.Fragment] {
+			c.problem(l.from, "Anker %s fehlt in %s", u.Fragment, target)
+		}
+	}
+}
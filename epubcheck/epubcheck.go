@@ -0,0 +1,102 @@
+// Package epubcheck checks ePub files for the mistakes
+// epubcheck would complain about.
+package epubcheck
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+)
+
+// Problem - A single finding in an ePub
+type Problem struct {
+	File    string // The file inside the ePub, empty for the ePub itself
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.File == "" {
+		return p.Message
+	}
+	return p.File + ": " + p.Message
+}
+
+// containerXML - Der feste Ort der container.xml
+const containerXML = "META-INF/container.xml"
+
+// Check - Checks the ePub filename. An error is only returned
+// if the file cannot be read as a zip archive at all.
+func Check(filename string) ([]Problem, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	c := &checker{files: map[string]*zip.File{}, ids: map[string]map[string]bool{}}
+	for _, f := range archive.File {
+		if _, ok := c.files[f.Name]; ok {
+			c.problem(f.Name, "ist mehrfach vorhanden")
+		}
+		c.files[f.Name] = f
+	}
+	c.checkMimetype(archive.File)
+	rootfile := c.checkContainer()
+	if rootfile == "" {
+		return c.problems, nil
+	}
+	pkg := c.checkPackage(rootfile)
+	if pkg == nil {
+		return c.problems, nil
+	}
+	c.checkUnlisted(archive.File, rootfile, pkg)
+	c.checkContents(pkg)
+	return c.problems, nil
+}
+
+type checker struct {
+	files    map[string]*zip.File
+	problems []Problem
+	// ids - Die ids jeder geprüften XML Datei für die Prüfung der Links
+	ids map[string]map[string]bool
+	// links - Die Verweise aller Dateien, geprüft wenn alle ids bekannt sind
+	links []link
+}
+
+func (c *checker) problem(file, format string, v ...interface{}) {
+	c.problems = append(c.problems, Problem{file, fmt.Sprintf(format, v...)})
+}
+
+// checkMimetype - mimetype muss der erste Eintrag sein, unkomprimiert
+// und ohne Extrafelder, und genau "application/epub+zip" enthalten
+func (c *checker) checkMimetype(files []*zip.File) {
+	if len(files) == 0 || files[0].Name != "mimetype" {
+		c.problem("mimetype", "ist nicht der erste Eintrag")
+	}
+	f, ok := c.files["mimetype"]
+	if !ok {
+		c.problem("mimetype", "fehlt")
+		return
+	}
+	if f.Method != zip.Store {
+		c.problem("mimetype", "ist komprimiert")
+	}
+	if len(f.Extra) > 0 {
+		c.problem("mimetype", "hat Extrafelder")
+	}
+	content, err := readFile(f)
+	if err != nil {
+		c.problem("mimetype", "nicht lesbar: %v", err)
+	} else if string(content) != "application/epub+zip" {
+		c.problem("mimetype", "enthält %q statt application/epub+zip", content)
+	}
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
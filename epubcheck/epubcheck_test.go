@@ -0,0 +1,167 @@
+package epubcheck
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+    <rootfiles>
+        <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+    </rootfiles>
+</container>`
+	testOPF = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId" version="3.0">
+    <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+        <dc:identifier id="BookId">test</dc:identifier>
+        <meta name="cover" content="titleImage" />
+    </metadata>
+    <manifest>
+        <item href="navigation.xhtml" id="navigation" media-type="application/xhtml+xml" properties="nav"/>
+        <item href="article_1.xhtml" id="article_1" media-type="application/xhtml+xml" />
+        <item href="images/title.jpg" id="titleImage" media-type="image/jpeg" />
+    </manifest>
+    <spine>
+        <itemref idref="navigation" />
+        <itemref idref="article_1" />
+    </spine>
+</package>`
+	testNAV = `<?xml version="1.0"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<body><nav><ol><li><a href="article_1.xhtml#text">Artikel</a></li></ol></nav></body>
+</html>`
+	testArticle = `<?xml version="1.0"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<body>
+<p id="text"><img src="images/title.jpg" alt=""/><a href="https://example.com/">extern</a></p>
+</body>
+</html>`
+)
+
+// testFile - Eine Datei im Test-ePub
+type testFile struct {
+	name    string
+	content string
+	method  uint16
+}
+
+func validFiles() []testFile {
+	return []testFile{
+		{"mimetype", "application/epub+zip", zip.Store},
+		{"META-INF/container.xml", testContainer, zip.Deflate},
+		{"OEBPS/content.opf", testOPF, zip.Deflate},
+		{"OEBPS/navigation.xhtml", testNAV, zip.Deflate},
+		{"OEBPS/article_1.xhtml", testArticle, zip.Deflate},
+		{"OEBPS/images/title.jpg", "\xff\xd8\xff", zip.Store},
+	}
+}
+
+func writeEpub(t *testing.T, files []testFile) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.epub")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for _, file := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: file.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// change - Ersetzt old durch new in der Datei name
+func change(name, old, new string) func([]testFile) []testFile {
+	return func(files []testFile) []testFile {
+		for i := range files {
+			if files[i].name == name {
+				files[i].content = strings.Replace(files[i].content, old, new, 1)
+			}
+		}
+		return files
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func([]testFile) []testFile
+		want   string
+	}{
+		{"valid", nil, ""},
+		{"mimetype not first", func(files []testFile) []testFile {
+			files[0], files[1] = files[1], files[0]
+			return files
+		}, "mimetype: ist nicht der erste Eintrag"},
+		{"mimetype compressed", func(files []testFile) []testFile {
+			files[0].method = zip.Deflate
+			return files
+		}, "mimetype: ist komprimiert"},
+		{"missing rootfile", change("META-INF/container.xml", "OEBPS/content.opf", "content.opf"),
+			"META-INF/container.xml: rootfile content.opf fehlt im ePub"},
+		{"missing file", func(files []testFile) []testFile {
+			return files[:len(files)-1]
+		}, "OEBPS/content.opf: OEBPS/images/title.jpg aus dem Manifest fehlt im ePub"},
+		{"unlisted file", func(files []testFile) []testFile {
+			return append(files, testFile{"OEBPS/extra.css", "", zip.Deflate})
+		}, "OEBPS/extra.css: fehlt im Manifest"},
+		{"duplicate manifest id", change("OEBPS/content.opf", `id="article_1"`, `id="navigation"`),
+			"OEBPS/content.opf: id navigation im Manifest mehrfach vergeben"},
+		{"unresolved idref", change("OEBPS/content.opf", `idref="article_1"`, `idref="article_2"`),
+			"OEBPS/content.opf: itemref article_2 fehlt im Manifest"},
+		{"no nav", change("OEBPS/content.opf", ` properties="nav"`, ""),
+			`OEBPS/content.opf: kein Eintrag im Manifest hat properties="nav"`},
+		{"malformed", change("OEBPS/article_1.xhtml", "</p>", ""),
+			"OEBPS/article_1.xhtml: ist kein wohlgeformtes XML"},
+		{"html entity", change("OEBPS/article_1.xhtml", "extern", "extern&nbsp;"),
+			"OEBPS/article_1.xhtml: ist kein wohlgeformtes XML"},
+		{"broken link", change("OEBPS/navigation.xhtml", "article_1.xhtml", "article_2.xhtml"),
+			"OEBPS/navigation.xhtml: Verweis auf OEBPS/article_2.xhtml führt ins Leere"},
+		{"broken anchor", change("OEBPS/navigation.xhtml", "#text", "#bild"),
+			"OEBPS/navigation.xhtml: Anker bild fehlt in OEBPS/article_1.xhtml"},
+		{"broken image", change("OEBPS/article_1.xhtml", "images/title.jpg", "images/titel.jpg"),
+			"OEBPS/article_1.xhtml: Verweis auf OEBPS/images/titel.jpg führt ins Leere"},
+		{"duplicate id", change("OEBPS/article_1.xhtml", "<img ", `<img id="text" `),
+			"OEBPS/article_1.xhtml: id text mehrfach vergeben"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := validFiles()
+			if tt.modify != nil {
+				files = tt.modify(files)
+			}
+			problems, err := Check(writeEpub(t, files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, p := range problems {
+				if tt.want != "" && strings.HasPrefix(p.String(), tt.want) {
+					found = true
+				} else if tt.want == "" {
+					t.Error(p)
+				}
+			}
+			if tt.want != "" && !found {
+				t.Errorf("%q nicht gemeldet, sondern %v", tt.want, problems)
+			}
+		})
+	}
+}
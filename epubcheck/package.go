@@ -0,0 +1,200 @@
+package epubcheck
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// container - Die container.xml, soweit sie geprüft wird
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage - Die content.opf, soweit sie geprüft wird
+type opfPackage struct {
+	Version          string `xml:"version,attr"`
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
+	Identifiers      []struct {
+		ID string `xml:"id,attr"`
+	} `xml:"metadata>identifier"`
+	Metas []struct {
+		Name    string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Items []item `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		Itemrefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+	References []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"guide>reference"`
+
+	// byID - Die Einträge des Manifests nach id
+	byID map[string]*item
+	// byPath - Die Einträge des Manifests nach ihrem Pfad im ePub
+	byPath map[string]*item
+}
+
+// item - Ein Eintrag im Manifest
+type item struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+
+	// path - Der Pfad im ePub
+	path string
+}
+
+// checkContainer - Liefert den Pfad der content.opf oder "", wenn die
+// container.xml fehlt oder keine vorhandene rootfile nennt
+func (c *checker) checkContainer() string {
+	f, ok := c.files[containerXML]
+	if !ok {
+		c.problem(containerXML, "fehlt")
+		return ""
+	}
+	var ct container
+	if !c.decode(f, &ct) {
+		return ""
+	}
+	for _, rootfile := range ct.Rootfiles {
+		if rootfile.MediaType != "application/oebps-package+xml" {
+			continue
+		}
+		if _, ok := c.files[rootfile.FullPath]; !ok {
+			c.problem(containerXML, "rootfile %s fehlt im ePub", rootfile.FullPath)
+			return ""
+		}
+		return rootfile.FullPath
+	}
+	c.problem(containerXML, "nennt keine rootfile")
+	return ""
+}
+
+// checkPackage - Prüft Manifest, Spine und Verweise der content.opf
+func (c *checker) checkPackage(rootfile string) *opfPackage {
+	pkg := &opfPackage{byID: map[string]*item{}, byPath: map[string]*item{}}
+	if !c.decode(c.files[rootfile], pkg) {
+		return nil
+	}
+	dir := path.Dir(rootfile)
+
+	identified := false
+	for _, identifier := range pkg.Identifiers {
+		identified = identified || identifier.ID == pkg.UniqueIdentifier
+	}
+	if !identified {
+		c.problem(rootfile, "unique-identifier %q verweist auf keinen dc:identifier", pkg.UniqueIdentifier)
+	}
+
+	nav := false
+	for i := range pkg.Items {
+		it := &pkg.Items[i]
+		switch {
+		case it.ID == "":
+			c.problem(rootfile, "Eintrag %s im Manifest ohne id", it.Href)
+		case pkg.byID[it.ID] != nil:
+			c.problem(rootfile, "id %s im Manifest mehrfach vergeben", it.ID)
+		default:
+			pkg.byID[it.ID] = it
+		}
+		if it.MediaType == "" {
+			c.problem(rootfile, "Eintrag %s im Manifest ohne media-type", it.ID)
+		}
+		it.path = resolve(dir, it.Href)
+		if it.path == "" {
+			c.problem(rootfile, "Eintrag %s im Manifest hat keine gültige href %q", it.ID, it.Href)
+			continue
+		}
+		if _, ok := c.files[it.path]; !ok {
+			c.problem(rootfile, "%s aus dem Manifest fehlt im ePub", it.path)
+		}
+		if pkg.byPath[it.path] != nil {
+			c.problem(rootfile, "%s steht mehrfach im Manifest", it.path)
+		}
+		pkg.byPath[it.path] = it
+		nav = nav || hasProperty(it.Properties, "nav")
+	}
+	if strings.HasPrefix(pkg.Version, "3") && !nav {
+		c.problem(rootfile, "kein Eintrag im Manifest hat properties=\"nav\"")
+	}
+
+	if pkg.Spine.Toc != "" && pkg.byID[pkg.Spine.Toc] == nil {
+		c.problem(rootfile, "spine toc %s fehlt im Manifest", pkg.Spine.Toc)
+	}
+	if len(pkg.Spine.Itemrefs) == 0 {
+		c.problem(rootfile, "spine ist leer")
+	}
+	for _, ref := range pkg.Spine.Itemrefs {
+		if pkg.byID[ref.IDRef] == nil {
+			c.problem(rootfile, "itemref %s fehlt im Manifest", ref.IDRef)
+		}
+	}
+	for _, meta := range pkg.Metas {
+		if meta.Name == "cover" && pkg.byID[meta.Content] == nil {
+			c.problem(rootfile, "Titelbild %s fehlt im Manifest", meta.Content)
+		}
+	}
+	for _, ref := range pkg.References {
+		c.links = append(c.links, link{rootfile, ref.Href})
+	}
+	return pkg
+}
+
+// checkUnlisted - Jede Datei außer mimetype, META-INF und der
+// content.opf selbst muss im Manifest stehen
+func (c *checker) checkUnlisted(files []*zip.File, rootfile string, pkg *opfPackage) {
+	for _, f := range files {
+		name := f.Name
+		if name == "mimetype" || name == rootfile || strings.HasPrefix(name, "META-INF/") || strings.HasSuffix(name, "/") {
+			continue
+		}
+		if pkg.byPath[name] == nil {
+			c.problem(name, "fehlt im Manifest")
+		}
+	}
+}
+
+// decode - Liest die XML Datei f nach v und meldet Fehler
+func (c *checker) decode(f *zip.File, v interface{}) bool {
+	content, err := readFile(f)
+	if err != nil {
+		c.problem(f.Name, "nicht lesbar: %v", err)
+		return false
+	}
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(v); err != nil {
+		c.problem(f.Name, "ist kein gültiges XML: %v", err)
+		return false
+	}
+	return true
+}
+
+// resolve - Der Pfad im ePub für den relativen Verweis href in dir,
+// ohne Anker. "" bei ungültigen oder externen Verweisen.
+func resolve(dir, href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return ""
+	}
+	return path.Join(dir, u.Path)
+}
+
+func hasProperty(properties, property string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
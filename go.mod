@@ -1,3 +1,9 @@
 module hradek.net/azdl
 
 go 1.15
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	golang.org/x/net v0.11.0
+	golang.org/x/term v0.10.0
+)
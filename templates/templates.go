@@ -30,17 +30,34 @@ var funcMap = template.FuncMap{
 			return `<navPoint id="id_` + strconv.Itoa(i) + `" playOrder="` + strconv.Itoa(i) + `">`
 		}
 	},
-	"noEntity": func(txt string) string {
-		return EntityReplace.Replace(txt)
-	},
+	"xml": XMLEscape,
+}
+
+// xmlEscaper - Die Zeichen, die in XML Text und Attributen maskiert werden
+var xmlEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;", `'`, "&#39;")
+
+// XMLEscape - Escapes text for XML content and attribute values in either
+// quotes. Characters not allowed in XML, e.g. control characters, are
+// removed.
+func XMLEscape(txt string) string {
+	txt = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r == 0xFFFE, r == 0xFFFF, r >= 0xD800 && r <= 0xDFFF:
+			return -1
+		}
+		return r
+	}, txt)
+	return xmlEscaper.Replace(txt)
 }
 
 // ContentOPF - Template used for the content.opf
 var ContentOPF = newTemplate("ContentOPF", funcMap, `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
-<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId" version="3.0">
+<package xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId" version="3.0" prefix="azdl: https://hradek.net/azdl/">
     <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
-        <dc:identifier id="BookId">{{.Ausgabe.Title}} - {{germanDate "2006-01-02" .Date}}</dc:identifier>
-        <dc:title>{{.Ausgabe.Title}} - {{germanDate "2006-01-02" .Date}}</dc:title>
+        <dc:identifier id="BookId">{{xml .Ausgabe.Title}} - {{germanDate "2006-01-02" .Date}}</dc:identifier>
+        <dc:title>{{xml .Ausgabe.Title}} - {{germanDate "2006-01-02" .Date}}</dc:title>
         <dc:creator id="author">ZVA Digital GmbH</dc:creator>
         <dc:publisher>Zeitungsverlag Aachen GmbH</dc:publisher>
         <dc:date>{{germanDate "2006-01-02" .Date}}</dc:date>
@@ -48,9 +65,10 @@ var ContentOPF = newTemplate("ContentOPF", funcMap, `<?xml version="1.0" encodin
         <meta name="cover" content="titleImage" />
         <meta property="dcterms:modified">{{now "2006-01-02T15:04:05Z" }}</meta>
         <meta property="file-as" refines="#author">ZVA Digital GmbH</meta>
-        <meta property="belongs-to-collection" id="collection">{{.Ausgabe.Title}} {{germanDate "2006" .Date}}</meta>
+        <meta property="belongs-to-collection" id="collection">{{xml .Ausgabe.Title}} {{germanDate "2006" .Date}}</meta>
         <meta refines="#collection" property="collection-type">series</meta>
         <meta refines="#collection" property="group-position">{{germanDate "01-02" .Date}}</meta>
+        <meta property="azdl:version">{{.Ausgabe.Version}}</meta>
     </metadata>
     <manifest>
 
@@ -63,12 +81,12 @@ var ContentOPF = newTemplate("ContentOPF", funcMap, `<?xml version="1.0" encodin
         {{- end}}
 
         {{- range .AlleArtikel}}
-        <item href="{{.Filename}}" id="{{.XMLID}}" media-type="application/xhtml+xml" />
+        <item href="{{xml .Filename}}" id="{{xml .XMLID}}" media-type="application/xhtml+xml" />
         {{- end}}
 
         {{- range .AlleBilder}}
         {{- if .Size}}
-        <item href="{{.Filename}}" id="image_{{.ID}}" media-type="image/jpeg" />
+        <item href="{{xml .Filename}}" id="image_{{xml .ID}}" media-type="image/jpeg" />
         {{- end}}
         {{- end}}
 
@@ -86,7 +104,7 @@ var ContentOPF = newTemplate("ContentOPF", funcMap, `<?xml version="1.0" encodin
 
         <itemref idref="seite_{{$pgidx}}" />
         {{- range .Sequence}}
-        <itemref idref="{{.Article.XMLID}}" />
+        <itemref idref="{{xml .Article.XMLID}}" />
         {{- end}}
         {{- end}}
 
@@ -105,40 +123,40 @@ var Seite = newTemplate("Seite", funcMap, `<?xml version='1.0'?>
 <html xmlns='http://www.w3.org/1999/xhtml'>
 <head>
     <meta http-equiv='Content-Type' content='text/html; charset=UTF-8'/>
-    <title>{{.Ausgabe.Title}}</title>
+    <title>{{xml .Ausgabe.Title}}</title>
     <link rel='stylesheet' type='text/css' href='zva.epub.css'/>
 </head>
 <body>
 <div class='ToC'>
-    <h1 class='title'>{{html .Seite.Title}}</h1>
+    <h1 class='title'>{{xml .Seite.Title}}</h1>
     {{- if .Prev.Title}}
-    <a class="previous-page" href="seite_{{.Prev.Index}}.xhtml">{{html .Prev.Title}}</a>
+    <a class="previous-page" href="seite_{{.Prev.Index}}.xhtml">{{xml .Prev.Title}}</a>
     {{- else}}
     <a class="previous-page" href="index.xhtml">Inhalt</a>
     {{- end}}
     {{- if .Next.Title}}
-    <a class="next-page" href="seite_{{.Next.Index}}.xhtml">{{html .Next.Title}}</a>
+    <a class="next-page" href="seite_{{.Next.Index}}.xhtml">{{xml .Next.Title}}</a>
     {{- else}}
     <a class="next-page" href="impressum.xhtml">Impressum</a>
     {{- end}}
     {{- if .Seite.Sequence}}
     {{- range .Seite.Sequence}}
     <div class='ToCentry'>
-        <a class='index-link' href='{{.Article.Filename}}'>
-            {{html .Article.AltTitle}}
+        <a class='index-link' href='{{xml .Article.Filename}}'>
+            {{xml .Article.AltTitle}}
         </a>
     </div>
     {{- end}}
     <div class="source">
-        <a class="external" href="{{.URL}}/#/read/{{.Ausgabe.Paper}}/{{.Ausgabe.Date}}?page={{.Seite.Index}}">
-        {{germanDate "02.01.2006" .Date}} / {{.Ausgabe.Title}} / Seite {{.Seite.Number}}
+        <a class="external" href="{{xml .URL}}/#/read/{{xml .Ausgabe.Paper}}/{{.Ausgabe.Date}}?page={{.Seite.Index}}">
+        {{germanDate "02.01.2006" .Date}} / {{xml .Ausgabe.Title}} / Seite {{.Seite.Number}}
         </a>
     </div>
     {{- else}}
     <div class="onlineonly">
         <p>
         Diese Seite ist leider nur
-        <a class="external" href="{{.URL}}/#/read/{{.Ausgabe.Paper}}/{{.Ausgabe.Date}}?page={{.Seite.Index}}">online</a>
+        <a class="external" href="{{xml .URL}}/#/read/{{xml .Ausgabe.Paper}}/{{.Ausgabe.Date}}?page={{.Seite.Index}}">online</a>
         oder im PDF verfügbar.
         </p>
     </div>
@@ -154,22 +172,22 @@ var Index = newTemplate("Index", funcMap, `<?xml version='1.0'?>
 <html xmlns='http://www.w3.org/1999/xhtml'>
 <head>
     <meta http-equiv='Content-Type' content='text/html; charset=UTF-8'/>
-    <title>{{html .Ausgabe.Title}}</title>
+    <title>{{xml .Ausgabe.Title}}</title>
     <link rel='stylesheet' type='text/css' href='zva.epub.css'/>
 </head>
 <body>
 <div class='ToC'>
-    <h1 class='title'>{{html .Ausgabe.Title}}</h1>
+    <h1 class='title'>{{xml .Ausgabe.Title}}</h1>
     {{- range $index, $elt := .Ausgabe.Titles}}
     <div class='ToCentry'>
         <a class='index-link' href='seite_{{$index}}.xhtml'>
-            {{html $elt}}
+            {{xml $elt}}
         </a>
     </div>
     {{- end}}
     <div class="source">
-        <a class="external" href="{{.URL}}/#/read/{{.Ausgabe.Paper}}/{{.Ausgabe.Date}}">
-        {{germanDate "02.01.2006" .Date}} / {{.Ausgabe.Title}}
+        <a class="external" href="{{xml .URL}}/#/read/{{xml .Ausgabe.Paper}}/{{.Ausgabe.Date}}">
+        {{germanDate "02.01.2006" .Date}} / {{xml .Ausgabe.Title}}
         </a>
     </div>
 </div>
@@ -183,11 +201,11 @@ var ToC = newTemplate("ToC", funcMap, `<?xml version="1.0" encoding="UTF-8" stan
 <ncx version="2005-1"
     xmlns="http://www.daisy.org/z3986/2005/ncx/">
     <head>
-        <meta content="{{.Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}" name="dc:Title"/>
-        <meta name="dtb:uid" content="{{.Ausgabe.Title}} - {{germanDate "2006-01-02" .Date }}"/>
+        <meta content="{{xml .Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}" name="dc:Title"/>
+        <meta name="dtb:uid" content="{{xml .Ausgabe.Title}} - {{germanDate "2006-01-02" .Date }}"/>
     </head>
     <docTitle>
-        <text>{{.Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</text>
+        <text>{{xml .Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</text>
     </docTitle>
     <navMap>
     {{call $navpoint "startseite"}}
@@ -206,15 +224,15 @@ var ToC = newTemplate("ToC", funcMap, `<?xml version="1.0" encoding="UTF-8" stan
     {{$id := printf "seite_%d" .Index}}
     {{call $navpoint $id}}
         <navLabel>
-            <text>{{html .Title}}</text>
+            <text>{{xml .Title}}</text>
         </navLabel>
         <content src="seite_{{.Index}}.xhtml"/>
         {{- range .Sequence}}
         {{call $navpoint .Article.XMLID}}
             <navLabel>
-                <text>{{html .Article.AltTitle}}</text>
+                <text>{{xml .Article.AltTitle}}</text>
             </navLabel>
-            <content src="{{.Article.Filename}}"/>
+            <content src="{{xml .Article.Filename}}"/>
         {{call $navpoint}}
         {{- end}}
     {{call $navpoint}}
@@ -234,21 +252,21 @@ var NAV = newTemplate("NAV", funcMap, `<?xml version="1.0" encoding="UTF-8" stan
 <!DOCTYPE html>
 <html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
 <head>
-    <title>{{.Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</title>
+    <title>{{xml .Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</title>
 </head>
 <body>
 <nav epub:type="toc">
-    <h1>{{.Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</h1>
+    <h1>{{xml .Ausgabe.Title}} - {{germanDate "02. Jan. 2006" .Date }}</h1>
     <ol>
         <li><a href="title.xhtml">Startseite</a></li>
         <li><a href="index.xhtml">Inhalt</a></li>
         {{- range .Seiten}}
         {{$id := printf "seite_%d" .Index}}
-        <li><a href="seite_{{.Index}}.xhtml">{{html .Title}}</a>
+        <li><a href="seite_{{.Index}}.xhtml">{{xml .Title}}</a>
             {{- if .Sequence }}
             <ol>
                 {{- range .Sequence}}
-                <li><a href="{{.Article.Filename}}">{{html .Article.AltTitle}}</a></li>
+                <li><a href="{{xml .Article.Filename}}">{{xml .Article.AltTitle}}</a></li>
                 {{- end}}
             </ol>
             {{- end}}
@@ -268,7 +286,7 @@ var Article = newTemplate("Article", funcMap, `<?xml version='1.0'?>
 
 <head>
     <meta http-equiv='Content-Type' content='text/html; charset=UTF-8' />
-    <title>{{html .A.AltTitle}}</title>
+    <title>{{xml .A.AltTitle}}</title>
     <link rel='stylesheet' type='text/css' href='zva.epub.css' />
 </head>
 
@@ -276,7 +294,7 @@ var Article = newTemplate("Article", funcMap, `<?xml version='1.0'?>
     <div class='article'>
         {{- if or .A.Title .A.Underline}}
         <div class='header'>
-            {{if .A.Title}}<h1>{{html .A.Title}}</h1>{{end}}
+            {{if .A.Title}}<h1>{{xml .A.Title}}</h1>{{end}}
             {{if .A.Underline}}{{.A.Underline}}{{end}}
         </div>
         {{- end}}
@@ -284,19 +302,19 @@ var Article = newTemplate("Article", funcMap, `<?xml version='1.0'?>
             {{- range .A.Pictures}}
         <div class="image">
             {{- if .Size}}
-            <img src="images/{{.ID}}.jpg" alt="ID={{.ID}}"/>
+            <img src="images/{{xml .ID}}.jpg" alt="ID={{xml .ID}}"/>
             {{- else}}
             <p class="imgerr">Dieses Bild konnte nicht geladen werden</p>
             {{- end}}
             {{- if .Description}}
-            <p class="imgdescription">{{noEntity .Description}}</p>
+            <p class="imgdescription">{{.Description}}</p>
             {{- end}}
         </div>
             {{- end}}
         {{- end}}
         {{- if .A.Author}}
         <div class='author'>
-            {{noEntity .A.Author}}
+            {{.A.Author}}
         </div>
         {{- end}}
         {{- if .A.Text}}
@@ -306,8 +324,8 @@ var Article = newTemplate("Article", funcMap, `<?xml version='1.0'?>
         {{- end}}
         {{- if ne .A.ID "Impressum"}}
         <div class="source">
-            <a class="external" href="{{.URL}}/#/read/{{.A.Paper.Paper}}/{{.A.Paper.Date}}?page={{.A.Paper.Page.Index}}&amp;article={{.A.ID}}">
-            {{germanDate "02.01.2006" .Date}} / {{.A.Paper.Title}} / Seite {{.A.Paper.Page.Number}} / {{html .A.Paper.Page.Title}}
+            <a class="external" href="{{xml .URL}}/#/read/{{xml .A.Paper.Paper}}/{{xml .A.Paper.Date}}?page={{.A.Paper.Page.Index}}&amp;article={{xml .A.ID}}">
+            {{germanDate "02.01.2006" .Date}} / {{xml .A.Paper.Title}} / Seite {{.A.Paper.Page.Number}} / {{xml .A.Paper.Page.Title}}
             </a>
         </div>
         {{- end}}
@@ -324,14 +342,14 @@ var DupArticle = newTemplate("Article", funcMap, `<?xml version='1.0'?>
 
 <head>
     <meta http-equiv='Content-Type' content='text/html; charset=UTF-8' />
-    <title>{{html .A.AltTitle}}</title>
+    <title>{{xml .A.AltTitle}}</title>
     <link rel='stylesheet' type='text/css' href='zva.epub.css' />
 </head>
 
 <body>
     <div class='article'>
         <div class='header'>
-            {{if .A.Title}}<h1>{{html .A.Title}}</h1>{{end}}
+            {{if .A.Title}}<h1>{{xml .A.Title}}</h1>{{end}}
             <p>Dieser Artikel befindet sich bereits auf {{.A.Underline}}</p>
         </div>
     </div>
@@ -401,11 +419,6 @@ var German = strings.NewReplacer(
 	"Sunday", "Sontag", "Sun", "Son",
 )
 
-// EntityReplace - Replaces - for now - only nbsp withh char(160)
-var EntityReplace = strings.NewReplacer(
-	"&nbsp;", "\u00A0",
-)
-
 const (
 	// TitlePage - The fixed content of the newspaper's title page
 	// The only thing changing on that page is the content of
@@ -646,15 +659,6 @@ var RemoveTags = regexp.MustCompile(`<[^>]+>`)
 // Shorten - shorten to at most 40 characters
 var Shorten = regexp.MustCompile(`^(.{0,40}\S*).*`)
 
-// NoLinkTarget - renove all target attributes from links
-var NoLinkTarget = regexp.MustCompile(`(<a\b[^>]*)\starget=".*?"`)
-
-// MTbr - replace all br with proper empty tags
-var MTbr = regexp.MustCompile(`<(br)\s*>`)
-
-// Ortsmarke - Remove blanks at the end of ".ortsmarke"
-var Ortsmarke = regexp.MustCompile(`(<[^>]+class="[^">]*\bortsmarke\b[^">]*"[^<]+?)( +)(</b\b)`)
-
 func newTemplate(name string, funcMap template.FuncMap, tpl string) *template.Template {
 	result, err := template.New(name).Funcs(funcMap).Parse(tpl)
 	if err != nil {
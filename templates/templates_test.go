@@ -0,0 +1,287 @@
+package templates_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"hradek.net/azdl/epaper"
+	"hradek.net/azdl/templates"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const url = "https://epaper.zeitungsverlag-aachen.de/2.0"
+
+var date = time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC)
+
+// pgInfo - Wie epaper.pgInfo für die Nachbarseiten
+type pgInfo struct {
+	Title string
+	Index int
+}
+
+// fixture - Eine kleine Ausgabe mit allen Sonderfällen: ein Artikel ohne
+// Titel und Bilder, ein fehlendes Bild, ein doppelter Artikel, eine
+// Seite, die es nur online gibt, und Titel mit & und <
+type fixture struct {
+	Ausgabe     *epaper.Ausgabe
+	Seiten      []*epaper.Seite
+	AlleArtikel map[string]*epaper.Article
+	AlleBilder  map[string]*epaper.Picture
+}
+
+func newFixture() *fixture {
+	ausgabe := &epaper.Ausgabe{
+		Paper:        "az-d",
+		Title:        "Dürener Zeitung & <Land>",
+		Date:         20201002,
+		Brand:        "az",
+		Pages:        3,
+		Titles:       []string{"TITELSEITE", "POLITIK & WIRTSCHAFT", "ANZEIGEN"},
+		Subscription: true,
+		Version:      1601596800,
+	}
+	seiten := make([]*epaper.Seite, ausgabe.Pages)
+	for i, title := range ausgabe.Titles {
+		seiten[i] = &epaper.Seite{
+			ID:     "20201002-" + string(rune('0'+i)),
+			Title:  title,
+			Number: i + 1,
+			Index:  i,
+		}
+	}
+	paper := func(seite *epaper.Seite) epaper.Paper {
+		return epaper.Paper{
+			Paper: ausgabe.Paper,
+			Date:  "20201002",
+			Title: ausgabe.Title,
+			Page:  epaper.Page{ID: seite.ID, Index: seite.Index, Number: seite.Number, Title: seite.Title},
+		}
+	}
+
+	bild := &epaper.Picture{
+		ID:          "2094290259_e7c39b54a0",
+		Type:        "picture",
+		Description: "Der Markt\u00a0in Düren",
+		Size:        1234,
+		Filename:    "images/2094290259_e7c39b54a0.jpg",
+	}
+	fehlt := &epaper.Picture{
+		ID:       "2094290260_0badc0ffee",
+		Type:     "picture",
+		Filename: "images/2094290260_0badc0ffee.jpg",
+	}
+	aufmacher := &epaper.Article{
+		ID:        "1001",
+		Type:      "article",
+		Title:     "Wochenmarkt <b>zieht</b> um",
+		Author:    "Von Anna\u00a0Beispiel",
+		Underline: "<p>Ab Samstag auf dem Kaiserplatz</p>",
+		Pictures:  []epaper.Picture{*bild},
+		Paper:     paper(seiten[0]),
+		Text:      `<p><b class="ortsmarke">Düren</b> Der Wochenmarkt zieht um.</p>`,
+		XMLID:     "article_1001",
+		AltTitle:  "Wochenmarkt zieht um",
+		Filename:  "article_1001.xhtml",
+	}
+	ohneTitel := &epaper.Article{
+		ID:       "1002",
+		Type:     "article",
+		Paper:    paper(seiten[0]),
+		Text:     "<p>Kurz notiert.</p>",
+		XMLID:    "article_1002",
+		AltTitle: "Kurz notiert: 3 < 4 & \"mehr\"",
+		Filename: "article_1002.xhtml",
+	}
+	ohneBild := &epaper.Article{
+		ID:       "1003",
+		Type:     "article",
+		Title:    "Haushalt beschlossen",
+		Pictures: []epaper.Picture{*fehlt},
+		Paper:    paper(seiten[1]),
+		Text:     "<p>Der Rat hat den Haushalt beschlossen.</p>",
+		XMLID:    "article_1003",
+		AltTitle: "Haushalt beschlossen",
+		Filename: "article_1003.xhtml",
+	}
+	doppelt := &epaper.Article{
+		ID:        "1001",
+		Type:      "article",
+		Title:     aufmacher.Title,
+		Underline: `<a href="article_1001.xhtml">Seite 1</a>`,
+		Paper:     paper(seiten[1]),
+		XMLID:     "duplicate_1",
+		AltTitle:  aufmacher.AltTitle,
+		Filename:  "duplicate_1.xhtml",
+	}
+
+	seiten[0].Sequence = []epaper.Element{{ID: "1001", Article: aufmacher}, {ID: "1002", Article: ohneTitel}}
+	seiten[1].Sequence = []epaper.Element{{ID: "1003", Article: ohneBild}, {ID: "1001", Article: doppelt}}
+	// seiten[2] gibt es nur online
+
+	return &fixture{
+		Ausgabe: ausgabe,
+		Seiten:  seiten,
+		AlleArtikel: map[string]*epaper.Article{
+			"1001":        aufmacher,
+			"1002":        ohneTitel,
+			"1003":        ohneBild,
+			"duplicate_1": doppelt,
+		},
+		AlleBilder: map[string]*epaper.Picture{
+			bild.Filename:  bild,
+			fehlt.Filename: fehlt,
+		},
+	}
+}
+
+// data - Die Daten für ContentOPF, ToC und NAV wie in CreateAzanEpub
+func (f *fixture) data() interface{} {
+	return struct {
+		URL         string
+		Ausgabe     *epaper.Ausgabe
+		Seiten      []*epaper.Seite
+		Date        time.Time
+		AlleArtikel map[string]*epaper.Article
+		AlleBilder  map[string]*epaper.Picture
+	}{url, f.Ausgabe, f.Seiten, date, f.AlleArtikel, f.AlleBilder}
+}
+
+func (f *fixture) seite(i int) interface{} {
+	var prev, next pgInfo
+	if i > 0 {
+		prev = pgInfo{f.Ausgabe.Titles[i-1], i - 1}
+	}
+	if i < len(f.Seiten)-1 {
+		next = pgInfo{f.Ausgabe.Titles[i+1], i + 1}
+	}
+	return struct {
+		URL     string
+		Ausgabe *epaper.Ausgabe
+		Seite   *epaper.Seite
+		Date    time.Time
+		Prev    pgInfo
+		Next    pgInfo
+	}{url, f.Ausgabe, f.Seiten[i], date, prev, next}
+}
+
+func (f *fixture) article(id string) interface{} {
+	return struct {
+		URL  string
+		A    *epaper.Article
+		Date time.Time
+	}{url, f.AlleArtikel[id], date}
+}
+
+// duplicate - Ein Duplikat des Aufmachers mit einem Titel, wie ihn clean
+// aus "Rat &amp; Verwaltung" macht
+func (f *fixture) duplicate(title string) interface{} {
+	doppelt := *f.AlleArtikel["duplicate_1"]
+	doppelt.Title = title
+	doppelt.AltTitle = title
+	return struct {
+		URL  string
+		A    *epaper.Article
+		Date time.Time
+	}{url, &doppelt, date}
+}
+
+func TestGolden(t *testing.T) {
+	f := newFixture()
+	tests := []struct {
+		golden string
+		tpl    *template.Template
+		data   interface{}
+	}{
+		{"content.opf", templates.ContentOPF, f.data()},
+		{"toc.ncx", templates.ToC, f.data()},
+		{"navigation.xhtml", templates.NAV, f.data()},
+		{"index.xhtml", templates.Index, struct {
+			URL     string
+			Ausgabe *epaper.Ausgabe
+			Date    time.Time
+		}{url, f.Ausgabe, date}},
+		{"seite_0.xhtml", templates.Seite, f.seite(0)},
+		{"seite_1.xhtml", templates.Seite, f.seite(1)},
+		{"seite_2-online.xhtml", templates.Seite, f.seite(2)},
+		{"article.xhtml", templates.Article, f.article("1001")},
+		{"article-no-title.xhtml", templates.Article, f.article("1002")},
+		{"article-missing-picture.xhtml", templates.Article, f.article("1003")},
+		{"duplicate.xhtml", templates.DupArticle, f.article("duplicate_1")},
+		{"duplicate-entity.xhtml", templates.DupArticle, f.duplicate("Rat & Verwaltung")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			// dcterms:modified darf sich nicht bei jedem Lauf ändern
+			tpl, err := tt.tpl.Clone()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tpl.Funcs(template.FuncMap{"now": func(format string) string {
+				return time.Date(2020, 10, 2, 6, 0, 0, 0, time.UTC).Format(format)
+			}})
+			var got bytes.Buffer
+			if err := tpl.Execute(&got, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			checkXML(t, got.Bytes())
+			compareGolden(t, filepath.Join("testdata", tt.golden+".golden"), got.Bytes())
+		})
+	}
+}
+
+// checkXML - Jede Vorlage muss wohlgeformtes XML ergeben
+func checkXML(t *testing.T, data []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("kein wohlgeformtes XML: %v", err)
+		}
+	}
+}
+
+// compareGolden - Vergleicht got mit der Datei golden bzw. schreibt sie mit -update
+func compareGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (mit -update erzeugen)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("%s:%d\n-%s\n+%s\n(mit -update übernehmen)", golden, i+1, w, g)
+			return
+		}
+	}
+}